@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Offline subcommand handler, returning the process exit code
+type subcommand struct {
+	Run  func(args []string) int
+	Help string
+}
+
+// Subcommands that run without a Discord token
+var subcommands = map[string]subcommand{
+	"convert":      {convertCommand, "convert decks between JSON, TSV and YAML formats"},
+	"diff":         {diffCommand, "compare two versions of a deck by card question"},
+	"export":       {exportCommand, "export decks to Anki packages or CSV/TSV files"},
+	"fetch-images": {fetchImagesCommand, "download remote images of decks into the assets folder"},
+	"import":       {importCommand, "import an Anki package or text export as a quiz deck"},
+	"render":       {renderCommand, "render deck questions as images to disk and time it"},
+	"validate":     {validateCommand, "check decks for problems and optionally write fixed copies"},
+}
+
+// Run given offline subcommand and return the process exit code
+func runSubcommand(args []string) int {
+
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n", args[0])
+		subcommandUsage()
+		return 2
+	}
+
+	return cmd.Run(args[1:])
+}
+
+// Print list of available subcommands
+func subcommandUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -t <token>\n   or: %s <command> [options]\n\nCommands:\n", os.Args[0], os.Args[0])
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, subcommands[name].Help)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Longest text in characters the draw command renders
+const DRAW_TEXT_MAX = 300
+
+// Colour names the draw command knows besides hex codes
+var ColourNames = map[string]color.RGBA{
+	"black":  {0x00, 0x00, 0x00, 0xFF},
+	"white":  {0xFF, 0xFF, 0xFF, 0xFF},
+	"grey":   {0x80, 0x80, 0x80, 0xFF},
+	"gray":   {0x80, 0x80, 0x80, 0xFF},
+	"red":    {0xCC, 0x22, 0x22, 0xFF},
+	"orange": {0xFF, 0x8C, 0x00, 0xFF},
+	"yellow": {0xFF, 0xD7, 0x00, 0xFF},
+	"green":  {0x22, 0x8B, 0x22, 0xFF},
+	"blue":   {0x1E, 0x5A, 0xC8, 0xFF},
+	"purple": {0x80, 0x30, 0xA0, 0xFF},
+	"pink":   {0xFF, 0x69, 0xB4, 0xFF},
+	"navy":   {0x00, 0x00, 0x80, 0xFF},
+}
+
+// Usage of the draw command
+var drawUsage = fmt.Sprintf("Usage: `%sdraw [--font <name>] [--size <small/normal/large/huge/N>] [--fg <colour>] [--bg <colour/transparent>] [--vertical] [--furigana] <text>`", CMD_PREFIX)
+
+// Draw text from a message into an image, with leading flags choosing how it looks
+func drawCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+
+	text, opts, err := parseDrawArgs(args, RenderOptions{Theme: userTheme(s, m.ChannelID, m.Author.ID)})
+	if err != nil {
+		msgSend(s, m.ChannelID, fmt.Sprintf("Error: %s\n%s", err, drawUsage))
+		return
+	}
+
+	imgOptionsSend(s, m.ChannelID, text, opts)
+}
+
+// Split the arguments of the draw command into text and render options
+// Flags like --size 96 or --size=96 go before the text, and -- ends them for text starting with dashes
+func parseDrawArgs(args string, opts RenderOptions) (string, RenderOptions, error) {
+
+	rest := strings.TrimLeftFunc(args, unicode.IsSpace)
+	for {
+		word, after := nextWord(rest)
+		if word == "--" {
+			rest = after
+			break
+		}
+
+		// Phones like to turn two dashes into a long one, which Japanese text uses too
+		var flag string
+		if strings.HasPrefix(word, "--") {
+			flag = word[2:]
+		} else if strings.HasPrefix(word, "—") && isDrawFlag(word[len("—"):]) {
+			flag = word[len("—"):]
+		} else {
+			break
+		}
+		rest = after
+
+		parts := strings.SplitN(strings.ToLower(flag), "=", 2)
+		name, value := parts[0], ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+
+		switch name {
+		case "vertical", "furigana":
+			enabled := len(parts) == 1 || isEnabled(value)
+			if name == "vertical" {
+				opts.Vertical = enabled
+			} else {
+				opts.Ruby = enabled
+			}
+			continue
+		case "font", "size", "fg", "bg":
+			if len(parts) == 1 {
+				value, rest = nextWord(rest)
+				value = strings.ToLower(value)
+			}
+			if len(value) == 0 {
+				return "", opts, fmt.Errorf("Flag --%s needs a value", name)
+			}
+		default:
+			return "", opts, fmt.Errorf("Unknown flag --%s", name)
+		}
+
+		var err error
+		switch name {
+		case "font":
+			if !isFont(value) {
+				err = fmt.Errorf("Unknown font '%s', available fonts: %s, %s", value, strings.Join(FontNames(), ", "), RANDOM_FONT)
+			}
+			opts.Font = value
+		case "size":
+			opts.Theme.Size, err = parseSize(value)
+		case "fg":
+			opts.Colours.Foreground, err = parseColour(value)
+		case "bg":
+			opts.Theme.Transparent = value == "transparent"
+			if !opts.Theme.Transparent {
+				opts.Colours.Background, err = parseColour(value)
+			}
+		}
+		if err != nil {
+			return "", opts, err
+		}
+	}
+
+	text := strings.Replace(strings.TrimSpace(rest), "\\n", "\n", -1)
+	if len(text) == 0 {
+		return "", opts, fmt.Errorf("Nothing to draw")
+	}
+	if n := utf8.RuneCountInString(text); n > DRAW_TEXT_MAX {
+		return "", opts, fmt.Errorf("Text is %d characters long, the most that can be drawn is %d", n, DRAW_TEXT_MAX)
+	}
+
+	return text, opts, nil
+}
+
+// Returns true if a word without dashes is one of the draw command's flags
+func isDrawFlag(word string) bool {
+	switch strings.ToLower(strings.SplitN(word, "=", 2)[0]) {
+	case "font", "size", "fg", "bg", "vertical", "furigana":
+		return true
+	}
+
+	return false
+}
+
+// Returns the first word of text and what follows it
+func nextWord(text string) (string, string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		return text, ""
+	}
+
+	return text[:end], text[end:]
+}
+
+// Returns the colour for a name or a hex code like #f80 or #ff8800
+func parseColour(value string) (color.RGBA, error) {
+
+	value = strings.ToLower(value)
+	if c, ok := ColourNames[value]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("Unknown colour '%s', use a hex code like #ff8800 or a name like red", value)
+	}
+
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xFF}, nil
+}
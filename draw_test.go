@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDrawArgs(t *testing.T) {
+
+	dark := Theme{Colours: "dark"}
+	tests := []struct {
+		args     string
+		text     string
+		expected RenderOptions
+	}{
+		{"漢字", "漢字", RenderOptions{Theme: dark}},
+		{"  two words\\nline ", "two words\nline", RenderOptions{Theme: dark}},
+		{"--vertical --furigana 漢字《かんじ》", "漢字《かんじ》", RenderOptions{Vertical: true, Ruby: true, Theme: dark}},
+		{"--VERTICAL=off --size large 漢字", "漢字", RenderOptions{Theme: Theme{Colours: "dark", Size: 96}}},
+		{"--size=72 --fg #f80 --bg=Navy 漢字", "漢字", RenderOptions{Theme: dark, Colours: Palette{Foreground: color.RGBA{0xFF, 0x88, 0x00, 0xFF}, Background: ColourNames["navy"]}}},
+		{"--bg transparent 漢字", "漢字", RenderOptions{Theme: Theme{Colours: "dark", Transparent: true}}},
+		{"—vertical 漢字", "漢字", RenderOptions{Vertical: true, Theme: dark}},
+		{"——ダッシュ", "——ダッシュ", RenderOptions{Theme: dark}},
+		{"-- --vertical", "--vertical", RenderOptions{Theme: dark}},
+		{"漢字 --vertical", "漢字 --vertical", RenderOptions{Theme: dark}},
+	}
+
+	for _, test := range tests {
+		text, opts, err := parseDrawArgs(test.args, RenderOptions{Theme: dark})
+		if err != nil {
+			t.Errorf("Parsing %q failed: %v", test.args, err)
+			continue
+		}
+		if text != test.text || !cmp.Equal(opts, test.expected) {
+			t.Errorf("Parsing %q gave %q with %+v, expected %q with %+v", test.args, text, opts, test.text, test.expected)
+		}
+	}
+
+	for _, args := range []string{"", "--vertical", "--size", "--size 500 漢字", "--size nan 漢字", "--size=NaN 漢字", "--size inf 漢字", "--size -Inf 漢字", "--fg nope 漢字", "--bold 漢字", "--font nope 漢字", strings.Repeat("字", DRAW_TEXT_MAX+1)} {
+		if _, _, err := parseDrawArgs(args, RenderOptions{}); err == nil {
+			t.Errorf("Parsing %q should fail", args)
+		}
+	}
+}
+
+func TestParseColour(t *testing.T) {
+
+	tests := map[string]color.RGBA{
+		"#ff8800": {0xFF, 0x88, 0x00, 0xFF},
+		"FF8800":  {0xFF, 0x88, 0x00, 0xFF},
+		"#f80":    {0xFF, 0x88, 0x00, 0xFF},
+		"White":   {0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	for value, expected := range tests {
+		if c, err := parseColour(value); err != nil || c != expected {
+			t.Errorf("Colour %q is %v (%v), expected %v", value, c, err, expected)
+		}
+	}
+
+	for _, value := range []string{"", "#ff88", "#gg8800", "+ff8800", "#ff880000"} {
+		if _, err := parseColour(value); err == nil {
+			t.Errorf("Colour %q should fail", value)
+		}
+	}
+}
+
+func TestDrawColours(t *testing.T) {
+
+	useTestFont(t)
+
+	// Custom colours go over the theme's palette
+	img := decodeRender(t, "draw", RenderOptions{Theme: Theme{Colours: "dark"}, Colours: Palette{Background: ColourNames["navy"]}})
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 != 0 || g>>8 != 0 || b>>8 != 0x80 {
+		t.Errorf("Background is %v, expected navy", img.At(0, 0))
+	}
+}
@@ -3,12 +3,14 @@ package main
 import (
 	"bytes"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
 	"io/ioutil"
 	"log"
 	"math"
-	"strings"
+	"math/rand"
+	"time"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
@@ -36,10 +38,103 @@ func loadFont() {
 	if err != nil {
 		log.Fatalln("ERROR, Parsing font:", err)
 	}
+
+	// Additional fonts are optional
+	loadFonts()
+}
+
+// Returns the width in pixels a line of text is drawn with
+// Without a loaded font the width is estimated from full and half width characters
+func measureText(line string) int {
+
+	if fontTtf == nil {
+		var width float64
+		for _, r := range line {
+			if r < 0x1100 || (r >= 0xFF61 && r <= 0xFFDC) {
+				width += fontSize / 2
+			} else {
+				width += fontSize
+			}
+		}
+		return int(width * fontDpi / 72)
+	}
+
+	face := newFallbackFace(fontChain(fontTtf), &truetype.Options{Size: fontSize, DPI: fontDpi})
+	return font.MeasureString(face, line).Round()
+}
+
+// Options for rendering text into images
+type RenderOptions struct {
+	Highlight string        // Text drawn in highlight colour
+	Distort   bool          // Distort glyphs and add noise against OCR
+	Font      string        // Font name from the fonts folder, empty for the main font
+	Vertical  bool          // Write in columns from right to left
+	Ruby      bool          // Draw ruby markup like 漢字《かんじ》 as furigana
+	Theme     Theme         // Colours, size and padding
+	Colours   Palette       // Custom colours going over the theme's, where set
+	Animate   bool          // Send an animated GIF counting down the answer window
+	Reveal    bool          // Animate characters appearing bit by bit, as a hint
+	Countdown time.Duration // Length of the answer window animations count down
+}
+
+// Generate a PNG image reader with given string written according to render options
+// Images that come out the same every time are served from the image cache
+func RenderImage(input string, opts RenderOptions) *bytes.Buffer {
+
+	// Still images look the same whatever the animation, and the theme only distorts through the quiz options,
+	// so neither splits the cache
+	opts.Animate, opts.Reveal, opts.Countdown = false, false, 0
+	opts.Theme.Distort = false
+
+	if !cacheable(opts) {
+		return renderImage(input, opts)
+	}
+	if data, ok := getCachedImage(input, opts); ok {
+		return bytes.NewBuffer(data)
+	}
+
+	buf := renderImage(input, opts)
+	if buf != nil {
+		putCachedImage(input, opts, buf.Bytes())
+	}
+
+	return buf
+}
+
+// Generate a PNG image reader with given string written according to render options, bypassing the cache
+func renderImage(input string, opts RenderOptions) *bytes.Buffer {
+
+	text := prepareText(input, opts)
+	if text == nil {
+		return nil
+	}
+	rgba := text.draw(len(text.Layout.Glyphs))
+
+	// Encode PNG image
+	var buf bytes.Buffer
+	err := png.Encode(&buf, rgba)
+	if err != nil {
+		log.Println("ERROR, Encoding PNG with '"+input+"':", err)
+		return &buf
+	}
+
+	return &buf
+}
+
+// Text laid out with its faces and colours, ready to be drawn
+type preparedText struct {
+	Layout     textLayout
+	Base       font.Face
+	Ruby       font.Face
+	Colours    Palette // Background jittered or cleared already
+	Margin     int
+	LineHeight int
+	Distort    bool
+	Seed       int64 // Distortions come out the same every time the text gets drawn
 }
 
-// Generate a PNG image reader with given string written
-func GenerateImage(input string) *bytes.Buffer {
+// Lay out text according to render options, nil if there is nothing to draw it with
+func prepareText(input string, opts RenderOptions) *preparedText {
 
 	if len(input) == 0 {
 		log.Println("ERROR, Can't generate image without input")
@@ -53,67 +148,125 @@ func GenerateImage(input string) *bytes.Buffer {
 		h = font.HintingFull
 	}
 
-	// Pick colours
-	fg, bg := image.Black, image.White
+	// Pick colours and size from the theme, custom colours going over its palette
+	text := &preparedText{Colours: opts.Theme.Palette().override(opts.Colours), Distort: opts.Distort}
+	if opts.Theme.Transparent {
+		text.Colours.Background = color.RGBA{}
+	}
+	size := fontSize
+	if opts.Theme.Size > 0 {
+		size = opts.Theme.Size
+	}
 
-	// Set up font drawer
-	d := &font.Drawer{
-		Src: fg,
-		Face: truetype.NewFace(fontTtf, &truetype.Options{
-			Size:    fontSize,
-			DPI:     fontDpi,
-			Hinting: h,
-		}),
+	// Distortions get their own random source, as rand.Rand isn't safe for concurrent use
+	if opts.Distort {
+		text.Seed = time.Now().UnixNano()
+		if text.Colours.Background.A == 0xFF {
+			rnd := rand.New(rand.NewSource(text.Seed))
+			text.Colours.Background = jitterColour(rnd, text.Colours.Background, DISTORT_COLOUR_JITTER/2)
+		}
 	}
 
-	// Prepare lines to be drawn
-	lines := strings.Split(input, "\n")
+	// Pick font, falling back to the main one
+	ttf, ok := getFont(opts.Font)
+	if !ok {
+		log.Println("ERROR, Unknown font:", opts.Font)
+		ttf = fontTtf
+	}
 
-	// Figure out image bounds
-	var widest int
-	for _, line := range lines {
-		width := d.MeasureString(line).Round()
-		if width > widest {
-			widest = width
-		}
+	// Runes missing from the font are drawn with the next font that has them
+	chain := fontChain(ttf)
+	if len(chain) == 0 {
+		log.Println("ERROR, Can't generate image without a font")
+		return nil
+	}
+	if missing := missingGlyphs(input, chain); len(missing) > 0 {
+		log.Printf("ERROR, No font has glyphs for '%s' in '%s'\n", string(missing), input)
 	}
 
-	lineHeight := int(math.Ceil(fontSize * fontDpi / 72 * 1.18))
-	imgW := widest * 11 / 10 // 10% extra for margins
-	imgH := len(lines) * lineHeight
+	// Leave room for padding and glyphs moved by the distortions
+	text.LineHeight = int(math.Ceil(size * fontDpi / 72 * LINE_SPACING))
+	text.Margin = opts.Theme.Padding
+	if opts.Distort {
+		text.Margin += distortMargin(text.LineHeight)
+	}
+
+	// Figure out glyph positions and image bounds, with ruby markup taken apart if asked for
+	text.Layout, text.Base, text.Ruby = fitText(input, opts, chain, size, text.Margin, h)
+
+	return text
+}
+
+// Draw the first count glyphs of prepared text onto a new canvas
+// Drawing fewer glyphs leaves the rest out without moving or distorting the others differently
+func (t *preparedText) draw(count int) *image.RGBA {
+
+	fg, bg, hl := t.Colours.Foreground, t.Colours.Background, t.Colours.Highlight
 
 	// Create image canvas
-	rgba := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
+	rgba := image.NewRGBA(image.Rect(0, 0, t.Layout.Width+2*t.Margin, t.Layout.Height+2*t.Margin))
+
+	// Draw the background
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(bg), image.ZP, draw.Src)
+	var rnd *rand.Rand
+	if t.Distort {
+		rnd = rand.New(rand.NewSource(t.Seed))
+		drawNoise(rnd, rgba, fg)
+	}
+
+	// Write out the text, switching colour for highlighted parts
+	drawGlyphs(rgba, t.Layout.Glyphs[:count], t.Base, t.Ruby, fg, hl, image.Pt(t.Margin, t.Margin), rnd)
 
-	// Draw the background and the guidelines
-	draw.Draw(rgba, rgba.Bounds(), bg, image.ZP, draw.Src)
+	if t.Distort {
+		baselines := make([]int, len(t.Layout.Baselines))
+		for i, y := range t.Layout.Baselines {
+			baselines[i] = y + t.Margin
+		}
+		rgba = distortImage(rand.New(rand.NewSource(t.Seed+1)), rgba, baselines, t.LineHeight, fg)
+	}
 
-	// Attach image to font drawer
-	d.Dst = rgba
+	return rgba
+}
 
-	// Figure out writing position
-	y := int(math.Ceil(fontSize * fontDpi / 72 * 0.94))
-	x := fixed.I(imgW-widest) / 2
-	for _, line := range lines {
-		d.Dot = fixed.Point26_6{
-			X: x,
-			Y: fixed.I(y),
+// Draw placed glyphs onto the canvas moved by offset
+// With a random source every glyph gets slightly rotated and its colour jittered against OCR
+func drawGlyphs(dst draw.Image, glyphs []placedGlyph, base font.Face, ruby font.Face, fg color.RGBA, hl color.RGBA, offset image.Point, rnd *rand.Rand) {
+	for _, glyph := range glyphs {
+		face, c := base, fg
+		if glyph.Ruby {
+			face = ruby
+		}
+		if glyph.Highlight {
+			c = hl
 		}
 
-		// Write out the text
-		d.DrawString(line)
+		var angle float64
+		if glyph.Turned {
+			angle = math.Pi / 2
+		}
+		if rnd != nil {
+			c = jitterColour(rnd, c, DISTORT_COLOUR_JITTER)
+			angle += (rnd.Float64()*2 - 1) * DISTORT_ROTATION_MAX * math.Pi / 180
+		}
 
-		// Advance line position
-		y += lineHeight
+		drawGlyph(dst, face, glyph.Rune, glyph.Dot.Add(fixed.P(offset.X, offset.Y)), image.NewUniform(c), angle)
 	}
+}
 
-	// Encode PNG image
-	var buf bytes.Buffer
-	err := png.Encode(&buf, rgba)
-	if err != nil {
-		log.Println("ERROR, Encoding PNG with '"+input+"':", err)
-		return &buf
+// Draw a single glyph with the pen at dot, rotated by angle radians around its centre
+func drawGlyph(dst draw.Image, face font.Face, r rune, dot fixed.Point26_6, src image.Image, angle float64) {
+
+	dr, mask, maskp, _, ok := face.Glyph(dot, r)
+	if !ok || dr.Empty() {
+		return
 	}
 
-	return &buf
+	if angle == 0 {
+		draw.DrawMask(dst, dr, src, image.ZP, mask, maskp, draw.Over)
+		return
+	}
+
+	// The mask is only valid until the next glyph lookup, so rotate it right away
+	rotated := rotateMask(mask, maskp, dr, angle)
+	draw.DrawMask(dst, rotated.Bounds(), src, image.ZP, rotated, rotated.Bounds().Min, draw.Over)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Render with the Go font, as the bot's own fonts are not part of the repository
+func useTestFont(t *testing.T) {
+	font, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := fontTtf
+	fontTtf = font
+	clearImageCache()
+	t.Cleanup(func() {
+		fontTtf = saved
+		clearImageCache()
+	})
+}
+
+func decodeRender(t *testing.T, input string, opts RenderOptions) image.Image {
+	buf := RenderImage(input, opts)
+	if buf == nil {
+		t.Fatalf("Rendering %q failed", input)
+	}
+
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func TestRenderImage(t *testing.T) {
+
+	useTestFont(t)
+
+	if RenderImage("", RenderOptions{}) != nil {
+		t.Error("Rendering without input should fail")
+	}
+
+	plain := decodeRender(t, "quiz\nline", RenderOptions{Highlight: "z"})
+	distorted := decodeRender(t, "quiz\nline", RenderOptions{Highlight: "z", Distort: true})
+
+	lineHeight := int(math.Ceil(fontSize * fontDpi / 72 * 1.18))
+	if plain.Bounds().Dy() != 2*lineHeight {
+		t.Errorf("Plain image has height %d, expected %d", plain.Bounds().Dy(), 2*lineHeight)
+	}
+
+	margin := distortMargin(lineHeight)
+	if distorted.Bounds().Dx() != plain.Bounds().Dx()+2*margin || distorted.Bounds().Dy() != plain.Bounds().Dy()+2*margin {
+		t.Errorf("Distorted image has size %v, expected %v with margin %d", distorted.Bounds(), plain.Bounds(), margin)
+	}
+
+	// Plain images only use the theme colours and their blends, with the highlight in red
+	var red int
+	b := plain.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, _, _ := plain.At(x, y).RGBA()
+			if r > g+0x4000 {
+				red++
+			}
+		}
+	}
+	if red == 0 {
+		t.Error("Highlighted text was not drawn in colour")
+	}
+}
+
+func TestRotateMask(t *testing.T) {
+
+	// A bar of 2x6 pixels in the middle of a larger mask
+	mask := image.NewAlpha(image.Rect(0, 0, 10, 20))
+	for y := 7; y < 13; y++ {
+		for x := 4; x < 6; x++ {
+			mask.SetAlpha(x, y, color.Alpha{0xFF})
+		}
+	}
+	dr := image.Rect(100, 100, 102, 106)
+	maskp := image.Pt(4, 7)
+
+	// Without rotation the bar stays in place, and nothing outside of it is picked up
+	same := rotateMask(mask, maskp, dr, 0)
+	for y := same.Bounds().Min.Y; y < same.Bounds().Max.Y; y++ {
+		for x := same.Bounds().Min.X; x < same.Bounds().Max.X; x++ {
+			inside := image.Pt(x, y).In(dr)
+			if a := same.AlphaAt(x, y).A; (a == 0xFF) != inside {
+				t.Fatalf("Unrotated mask has alpha %d at %d,%d", a, x, y)
+			}
+		}
+	}
+
+	// A quarter turn lays the bar down around the same centre
+	turned := rotateMask(mask, maskp, dr, math.Pi/2)
+	if turned.AlphaAt(98, 103).A != 0xFF || turned.AlphaAt(103, 102).A != 0xFF || turned.AlphaAt(101, 100).A != 0 {
+		t.Errorf("Rotated mask is not lying down: %v", turned.Pix)
+	}
+}
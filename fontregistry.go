@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Folder with additional fonts, registered by file name without extension
+const FONTS_FOLDER = RESOURCES_FOLDER + "fonts/"
+
+// Font names for the main font and for picking a different font for every image
+const (
+	DEFAULT_FONT = "default"
+	RANDOM_FONT  = "random"
+)
+
+// Fonts keeps the additional fonts by name, like mincho or textbook
+var Fonts struct {
+	sync.RWMutex
+	Map map[string]*truetype.Font
+}
+
+// Load all TrueType fonts and collections from the fonts folder
+func loadFonts() {
+
+	fonts := make(map[string]*truetype.Font)
+	files, err := ioutil.ReadDir(FONTS_FOLDER)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("ERROR, Reading fonts folder:", err)
+	}
+
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || (ext != ".ttf" && ext != ".ttc") {
+			continue
+		}
+
+		fontBytes, err := ioutil.ReadFile(FONTS_FOLDER + file.Name())
+		if err != nil {
+			log.Println("ERROR, Loading font:", err)
+			continue
+		}
+
+		ttf, err := truetype.Parse(fontBytes)
+		if err != nil {
+			log.Printf("ERROR, Parsing font %s: %s\n", file.Name(), err)
+			continue
+		}
+
+		fonts[strings.ToLower(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())))] = ttf
+	}
+
+	Fonts.Lock()
+	Fonts.Map = fonts
+	Fonts.Unlock()
+
+	// Cached images may have been drawn with other fonts
+	clearImageCache()
+}
+
+// Returns the names of all usable fonts, the main font first
+func FontNames() []string {
+
+	Fonts.RLock()
+	names := make([]string, 0, len(Fonts.Map))
+	for name := range Fonts.Map {
+		if name != DEFAULT_FONT {
+			names = append(names, name)
+		}
+	}
+	Fonts.RUnlock()
+	sort.Strings(names)
+
+	return append([]string{DEFAULT_FONT}, names...)
+}
+
+// Returns true if a font of that name can be used for rendering, including the random font
+func isFont(name string) bool {
+	if strings.ToLower(name) == RANDOM_FONT {
+		return true
+	}
+	_, ok := getFont(name)
+
+	return ok
+}
+
+// Tell the channel about an unknown font given as quiz option, returns false if there was one
+func checkFontOption(s *discordgo.Session, cid string, opts map[string]string) bool {
+	if name, ok := opts["font"]; ok && !isFont(name) {
+		msgSend(s, cid, fmt.Sprintf("Error: Unknown font '%s', available fonts: %s, %s", name, strings.Join(FontNames(), ", "), RANDOM_FONT))
+		return false
+	}
+
+	return true
+}
+
+// Returns the font of a given name, picking any of them for the random font
+// An empty name stands for the main font
+func getFont(name string) (*truetype.Font, bool) {
+
+	name = strings.ToLower(name)
+	switch name {
+	case "", DEFAULT_FONT:
+		return fontTtf, fontTtf != nil
+	case RANDOM_FONT:
+		names := FontNames()
+		name = names[rand.Intn(len(names))]
+		if name == DEFAULT_FONT {
+			return fontTtf, fontTtf != nil
+		}
+	}
+
+	Fonts.RLock()
+	ttf, ok := Fonts.Map[name]
+	Fonts.RUnlock()
+
+	return ttf, ok
+}
+
+// Returns the fonts tried in order for every rune: the chosen font, the main font and then all others by name
+func fontChain(first *truetype.Font) []*truetype.Font {
+
+	chain := []*truetype.Font{}
+	add := func(ttf *truetype.Font) {
+		if ttf == nil {
+			return
+		}
+		for _, f := range chain {
+			if f == ttf {
+				return
+			}
+		}
+		chain = append(chain, ttf)
+	}
+
+	add(first)
+	add(fontTtf)
+	for _, name := range FontNames()[1:] {
+		ttf, _ := getFont(name)
+		add(ttf)
+	}
+
+	return chain
+}
+
+// Returns the runes of the text that none of the fonts have a glyph for, without repeats
+func missingGlyphs(text string, fonts []*truetype.Font) []rune {
+
+	var missing []rune
+outer:
+	for _, r := range text {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			continue
+		}
+		for _, ttf := range fonts {
+			if ttf.Index(r) != 0 {
+				continue outer
+			}
+		}
+		for _, m := range missing {
+			if m == r {
+				continue outer
+			}
+		}
+		missing = append(missing, r)
+	}
+
+	return missing
+}
+
+// Font face drawing every rune with the first font of a chain that has a glyph for it
+type fallbackFace struct {
+	fonts    []*truetype.Font
+	faces    []font.Face
+	advances map[rune]fixed.Int26_6 // Cached, hinting makes advances slow to work out
+}
+
+// Returns a face for the font chain with the given options
+func newFallbackFace(fonts []*truetype.Font, opts *truetype.Options) *fallbackFace {
+	f := &fallbackFace{fonts: fonts, advances: make(map[rune]fixed.Int26_6)}
+	for _, ttf := range fonts {
+		f.faces = append(f.faces, truetype.NewFace(ttf, opts))
+	}
+
+	return f
+}
+
+// Returns the face drawing a rune, the first one if no font has it so it shows up as missing glyph box
+func (f *fallbackFace) face(r rune) font.Face {
+	for i, ttf := range f.fonts {
+		if ttf.Index(r) != 0 {
+			return f.faces[i]
+		}
+	}
+
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.face(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.face(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	if advance, ok := f.advances[r]; ok {
+		return advance, true
+	}
+
+	advance, ok := f.face(r).GlyphAdvance(r)
+	if ok {
+		f.advances[r] = advance
+	}
+
+	return advance, ok
+}
+
+// Kerning only applies between runes drawn with the same font
+func (f *fallbackFace) Kern(r0 rune, r1 rune) fixed.Int26_6 {
+	if face := f.face(r0); face == f.face(r1) {
+		return face.Kern(r0, r1)
+	}
+
+	return 0
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+func TestFontRegistry(t *testing.T) {
+
+	useTestFont(t)
+	mono, err := truetype.Parse(gomono.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Fonts.Lock()
+	saved := Fonts.Map
+	Fonts.Map = map[string]*truetype.Font{"mincho": mono, "gothic": mono}
+	Fonts.Unlock()
+	defer func() {
+		Fonts.Lock()
+		Fonts.Map = saved
+		Fonts.Unlock()
+	}()
+
+	if names := FontNames(); !cmp.Equal(names, []string{"default", "gothic", "mincho"}) {
+		t.Errorf("Font names are %v", names)
+	}
+
+	if ttf, ok := getFont("Mincho"); !ok || ttf != mono {
+		t.Error("Font lookup should ignore case")
+	}
+	if ttf, ok := getFont(""); !ok || ttf != fontTtf {
+		t.Error("Empty font name should give the main font")
+	}
+	if _, ok := getFont("comic"); ok || isFont("comic") {
+		t.Error("Unknown font should not be found")
+	}
+	if !isFont("random") {
+		t.Error("Random font should be accepted")
+	}
+	for i := 0; i < 10; i++ {
+		if ttf, ok := getFont("random"); !ok || (ttf != mono && ttf != fontTtf) {
+			t.Fatal("Random font should be one of the loaded fonts")
+		}
+	}
+
+	// Images get drawn in the chosen font, which differs in width here
+	if RenderImage("il", RenderOptions{Font: "mincho"}).Len() == RenderImage("il", RenderOptions{}).Len() {
+		t.Error("Image in another font came out the same")
+	}
+}
+
+func TestGlyphValidation(t *testing.T) {
+
+	useTestFont(t)
+
+	if missing := missingGlyphs("a 漢b漢\n㐀", fontChain(fontTtf)); string(missing) != "漢㐀" {
+		t.Errorf("Missing glyphs are %q", string(missing))
+	}
+
+	quiz := Quiz{Font: "comic", Deck: []Card{
+		{Question: "word", Answers: []string{"a"}},
+		{Question: "漢字", Answers: []string{"かんじ"}},
+		{Question: "word", Context: "in a 文", Answers: []string{"b"}},
+		{Question: "漢字", Answers: []string{"かんじ"}, Type: "text"},
+	}}
+
+	expected := []string{
+		"Found unknown font comic",
+		"Found characters without glyphs in any font: 漢字",
+		"Found characters without glyphs in any font: 文",
+	}
+	var messages []string
+	for _, issue := range (glyphValidator{}).Check(quiz) {
+		messages = append(messages, issue.Message)
+	}
+	if !cmp.Equal(messages, expected) {
+		t.Errorf("Check glyphs reported %v", messages)
+	}
+}
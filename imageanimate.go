@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"log"
+	"time"
+)
+
+// Most frames an animation gets, and the height of the countdown bar below the text in pixels
+const (
+	ANIMATION_FRAMES_MAX = 40
+	COUNTDOWN_BAR_HEIGHT = 10
+)
+
+// Share of the answer window hint animations take until the whole question shows
+const REVEAL_SHARE = 0.5
+
+// Shades blended between the background and each of the text colours in animation frames
+const ANIMATION_SHADES = 64
+
+// Generate an animated GIF reader with given string written according to render options
+// A bar below the text runs out over the countdown, and with Reveal the characters show up bit by bit
+func RenderAnimation(input string, opts RenderOptions) *bytes.Buffer {
+
+	if opts.Countdown <= 0 {
+		log.Println("ERROR, Can't animate '"+input+"' without countdown:", opts.Countdown)
+		return nil
+	}
+
+	text := prepareText(input, opts)
+	if text == nil {
+		return nil
+	}
+
+	// About a frame per second, with the last one showing the bar run out
+	frames := int(opts.Countdown / time.Second)
+	if frames < 1 {
+		frames = 1
+	} else if frames > ANIMATION_FRAMES_MAX {
+		frames = ANIMATION_FRAMES_MAX
+	}
+	delay := int(opts.Countdown / time.Duration(frames) / (10 * time.Millisecond))
+
+	palette := animationPalette(text.Colours)
+	indices := make(map[color.RGBA]uint8)
+	glyphs := len(text.Layout.Glyphs)
+
+	var anim gif.GIF
+	anim.LoopCount = -1 // Play once, stopping on the run out bar
+
+	var still, prev *image.RGBA
+	shown := -1
+	for i := 0; i <= frames; i++ {
+		count := glyphs
+		if opts.Reveal {
+			count = revealCount(glyphs, i, frames)
+		}
+		if count != shown {
+			still, shown = text.draw(count), count
+		}
+
+		// Text on top, the bar shrinking from the right below it
+		b := still.Bounds()
+		frame := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()+2*COUNTDOWN_BAR_HEIGHT))
+		draw.Draw(frame, frame.Bounds(), image.NewUniform(text.Colours.Background), image.ZP, draw.Src)
+		draw.Draw(frame, b, still, b.Min, draw.Src)
+		bar := image.Rect(0, b.Dy()+COUNTDOWN_BAR_HEIGHT/2, b.Dx()*(frames-i)/frames, b.Dy()+COUNTDOWN_BAR_HEIGHT*3/2)
+		draw.Draw(frame, bar, image.NewUniform(text.Colours.Highlight), image.ZP, draw.Src)
+
+		// Later frames only carry what changed, frames without changes lengthen the one before
+		r := frame.Bounds()
+		if prev != nil {
+			r = changedBounds(prev, frame)
+			if r.Empty() {
+				anim.Delay[len(anim.Delay)-1] += delay
+				continue
+			}
+		}
+		anim.Image = append(anim.Image, quantize(frame, r, palette, indices))
+		if i == frames {
+			delay = 0 // The run out bar stays
+		}
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		prev = frame
+	}
+	anim.Config = image.Config{ColorModel: palette, Width: prev.Bounds().Dx(), Height: prev.Bounds().Dy()}
+
+	// Encode GIF animation
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &anim)
+	if err != nil {
+		log.Println("ERROR, Encoding GIF with '"+input+"':", err)
+		return nil
+	}
+
+	return &buf
+}
+
+// Returns how many glyphs show in a frame of a hint animation, all of them after the reveal share of frames
+func revealCount(glyphs int, frame int, frames int) int {
+
+	steps := int(float64(frames) * REVEAL_SHARE)
+	if steps < 1 {
+		steps = 1
+	}
+
+	count := (glyphs*(frame+1) + steps - 1) / steps
+	if count > glyphs {
+		count = glyphs
+	}
+
+	return count
+}
+
+// Returns the colours of animation frames, blends from the background to the text and highlight colours
+func animationPalette(colours Palette) color.Palette {
+
+	var palette color.Palette
+	for _, c := range []color.RGBA{colours.Foreground, colours.Highlight} {
+		for i := 0; i < ANIMATION_SHADES; i++ {
+			palette = append(palette, blendColour(colours.Background, c, float64(i)/(ANIMATION_SHADES-1)))
+		}
+	}
+
+	return palette
+}
+
+// Returns the colour part way from a to b
+func blendColour(a color.RGBA, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x)*(1-t) + float64(y)*t + 0.5)
+	}
+
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// Convert part of an image to the closest palette colours, remembering colours seen before
+func quantize(src *image.RGBA, r image.Rectangle, palette color.Palette, indices map[color.RGBA]uint8) *image.Paletted {
+
+	dst := image.NewPaletted(r, palette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			index, ok := indices[c]
+			if !ok {
+				index = uint8(palette.Index(c))
+				indices[c] = index
+			}
+			dst.SetColorIndex(x, y, index)
+		}
+	}
+
+	return dst
+}
+
+// Returns the smallest rectangle holding every pixel that differs between two images of the same size
+func changedBounds(a *image.RGBA, b *image.RGBA) image.Rectangle {
+
+	var changed image.Rectangle
+	bounds := b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+
+		first, last := len(rowB), 0
+		for i := 0; i < len(rowB); i += 4 {
+			if !bytes.Equal(rowA[i:i+4], rowB[i:i+4]) {
+				if i < first {
+					first = i
+				}
+				last = i
+			}
+		}
+		changed = changed.Union(image.Rect(bounds.Min.X+first/4, y, bounds.Min.X+last/4+1, y+1))
+	}
+
+	return changed
+}
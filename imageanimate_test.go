@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func decodeAnimation(t *testing.T, input string, opts RenderOptions) *gif.GIF {
+	buf := RenderAnimation(input, opts)
+	if buf == nil {
+		t.Fatalf("Animating %q failed", input)
+	}
+
+	anim, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return anim
+}
+
+func TestRenderAnimation(t *testing.T) {
+
+	useTestFont(t)
+
+	if RenderAnimation("quiz", RenderOptions{}) != nil {
+		t.Error("Animating without countdown should fail")
+	}
+
+	// The countdown adds a bar below the still image and lasts as long as the answer window
+	still := decodeRender(t, "quiz", RenderOptions{})
+	countdown := decodeAnimation(t, "quiz", RenderOptions{Countdown: 20 * time.Second})
+	if countdown.Config.Width != still.Bounds().Dx() || countdown.Config.Height != still.Bounds().Dy()+2*COUNTDOWN_BAR_HEIGHT {
+		t.Errorf("Countdown has size %dx%d, expected the still image %v with a bar", countdown.Config.Width, countdown.Config.Height, still.Bounds())
+	}
+	if len(countdown.Image) != 21 || countdown.Delay[0] != 100 {
+		t.Errorf("Countdown has %d frames with delays %v, expected 21 frames of a second", len(countdown.Image), countdown.Delay)
+	}
+
+	// Only the bar changes after the first frame
+	for _, frame := range countdown.Image[1:] {
+		if frame.Bounds().Min.Y < still.Bounds().Dy() {
+			t.Fatalf("Countdown frame %v redraws the text", frame.Bounds())
+		}
+	}
+
+	// Hints draw more text in the first half, and nothing but the bar after
+	reveal := decodeAnimation(t, "quiz", RenderOptions{Countdown: 8 * time.Second, Reveal: true})
+	var total int
+	for i, frame := range reveal.Image {
+		if i > 0 && i < 4 && frame.Bounds().Min.Y >= still.Bounds().Dy() {
+			t.Errorf("Hint frame %d at %v reveals no text", i, frame.Bounds())
+		}
+		if i >= 4 && frame.Bounds().Min.Y < still.Bounds().Dy() {
+			t.Errorf("Hint frame %d at %v redraws the text", i, frame.Bounds())
+		}
+		total += reveal.Delay[i]
+	}
+	if total != 800 {
+		t.Errorf("Hint animation lasts %d hundredths of a second, expected 800", total)
+	}
+}
+
+func TestRevealCount(t *testing.T) {
+	var counts []int
+	for i := 0; i <= 6; i++ {
+		counts = append(counts, revealCount(7, i, 6))
+	}
+
+	if expected := []int{3, 5, 7, 7, 7, 7, 7}; !cmp.Equal(counts, expected) {
+		t.Errorf("Revealed glyph counts are %v, expected %v", counts, expected)
+	}
+}
+
+func TestChangedBounds(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	b := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if r := changedBounds(a, b); !r.Empty() {
+		t.Errorf("Equal images changed in %v", r)
+	}
+
+	b.SetRGBA(2, 7, color.RGBA{0xFF, 0, 0, 0xFF})
+	b.SetRGBA(5, 3, color.RGBA{0, 0, 0xFF, 0xFF})
+	if r := changedBounds(a, b); r != image.Rect(2, 3, 6, 8) {
+		t.Errorf("Images changed in %v, expected %v", r, image.Rect(2, 3, 6, 8))
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Folder inside the quizzes folder for local image assets
+const QUIZ_ASSETS_FOLDER = QUIZ_FOLDER + "assets/"
+
+// AssetPathError is returned for image asset paths that are absolute or lead out of the assets folder
+type AssetPathError struct {
+	Path string
+}
+
+func (e *AssetPathError) Error() string {
+	return fmt.Sprintf("Image path '%s' is not inside %s", e.Path, QUIZ_ASSETS_FOLDER)
+}
+
+// Returns the file of an image asset path given relative to the quizzes folder
+// Paths have to stay inside the assets folder, so decks can't read any other file
+func assetFile(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", &AssetPathError{Path: path}
+	}
+
+	filename := filepath.Clean(filepath.Join(QUIZ_FOLDER, path))
+	if !strings.HasPrefix(filename, filepath.Clean(QUIZ_ASSETS_FOLDER)+string(filepath.Separator)) {
+		return "", &AssetPathError{Path: path}
+	}
+
+	return filename, nil
+}
+
+// Load a local image asset, cropping to a centered square and scaling
+// down to fit maxSize if requested, and return it ready for upload
+func loadImageAsset(path string, maxSize int, crop bool) (*bytes.Buffer, string, error) {
+
+	filename, err := assetFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	// Nothing to process, send the file as is
+	if maxSize <= 0 && !crop {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(file); err != nil {
+			return nil, "", err
+		}
+		return &buf, filepath.Base(path), nil
+	}
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not decode image '%s': %s", path, err)
+	}
+
+	// Figure out source area
+	bounds := src.Bounds()
+	if crop {
+		side := minint(bounds.Dx(), bounds.Dy())
+		x := bounds.Min.X + (bounds.Dx()-side)/2
+		y := bounds.Min.Y + (bounds.Dy()-side)/2
+		bounds = image.Rect(x, y, x+side, y+side)
+	}
+
+	// Figure out target size, only ever scaling down
+	w, h := bounds.Dx(), bounds.Dy()
+	if maxSize > 0 && (w > maxSize || h > maxSize) {
+		if w >= h {
+			w, h = maxSize, maxint(h*maxSize/w, 1)
+		} else {
+			w, h = maxint(w*maxSize/h, 1), maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, xdraw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, "", err
+	}
+
+	return &buf, "image.png", nil
+}
+
+// Check that a local image asset exists and can be decoded
+func checkImageAsset(path string) error {
+
+	filename, err := assetFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, _, err := image.DecodeConfig(file); err != nil {
+		return fmt.Errorf("Could not decode image '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+// Characters allowed in names of downloaded image assets
+var assetNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Returns the address of the image itself for image host page links
+func directImageURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	// Imgur serves the image under any extension
+	if (u.Host == "imgur.com" || u.Host == "www.imgur.com") && len(path.Ext(u.Path)) == 0 {
+		return "https://i.imgur.com" + u.Path + ".png"
+	}
+
+	return link
+}
+
+// Download a remote image into the assets folder of a deck, returning its asset path
+func fetchImageAsset(link string, deck string, index int) (string, error) {
+
+	resp, err := http.Get(directImageURL(link))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not download image '%s': %s", link, resp.Status)
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode image '%s': %s", link, err)
+	}
+
+	// Keep the name the host gave the image where it's safe to
+	name := strings.TrimSuffix(path.Base(resp.Request.URL.Path), path.Ext(resp.Request.URL.Path))
+	if !assetNameRegex.MatchString(name) {
+		name = fmt.Sprintf("%d", index+1)
+	}
+	assetPath := path.Join("assets", deck, name+"."+format)
+
+	filename, err := assetFile(assetPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", err
+	}
+
+	return assetPath, ioutil.WriteFile(filename, data, 0644)
+}
+
+// Move the remote images of a quiz into its assets folder, turning url cards into image cards
+// Cards whose images fail to download keep their links, the errors are returned along with the quiz
+func fetchImageAssets(quiz Quiz, deck string) (Quiz, int, []error) {
+
+	var count int
+	var errs []error
+	deckType := quiz.Type
+	quiz.Deck = append([]Card{}, quiz.Deck...)
+	for i, card := range quiz.Deck {
+		if quiz.CardType(card) == "url" && isURL(card.Question) {
+			if assetPath, err := fetchImageAsset(card.Question, deck, i); err != nil {
+				errs = append(errs, err)
+			} else {
+				quiz.Deck[i].Question = assetPath
+				quiz.Deck[i].Type = "image"
+				count++
+			}
+		}
+
+		if isURL(card.Image) {
+			if assetPath, err := fetchImageAsset(card.Image, deck, i); err != nil {
+				errs = append(errs, err)
+			} else {
+				quiz.Deck[i].Image = assetPath
+				count++
+			}
+		}
+	}
+
+	// Whole url decks become image decks once nothing is left to link to
+	if deckType == "url" && len(errs) == 0 {
+		quiz.Type = "image"
+		for i := range quiz.Deck {
+			if quiz.Deck[i].Type == "image" {
+				quiz.Deck[i].Type = ""
+			}
+		}
+	}
+
+	return quiz, count, errs
+}
+
+// Download the remote images of given decks into the assets folder and point the decks at them
+func fetchImagesCommand(args []string) int {
+
+	fs := flag.NewFlagSet("fetch-images", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s fetch-images <deck...>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := loadQuizList(); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Loading quiz list:", err)
+		return 1
+	}
+
+	status := 0
+	for _, name := range fs.Args() {
+		info, ok := GetQuizInfo(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "ERROR, Unknown quiz '%s'\n", name)
+			status = 1
+			continue
+		}
+
+		// Work on the deck file itself, so included decks stay untouched
+		file, err := os.Open(QUIZ_FOLDER + info.File)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Reading quiz:", err)
+			status = 1
+			continue
+		}
+		quiz, err := decodeQuiz(info.File, file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Decoding quiz:", err)
+			status = 1
+			continue
+		}
+
+		quiz, count, errs := fetchImageAssets(quiz, name)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "ERROR,", err)
+			status = 1
+		}
+		if count == 0 {
+			continue
+		}
+		if err := writeQuiz(QUIZ_FOLDER+info.File, quiz); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Writing quiz:", err)
+			status = 1
+			continue
+		}
+		fmt.Printf("Fetched %d images of %s into %s%s/\n", count, name, QUIZ_ASSETS_FOLDER, name)
+	}
+
+	return status
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Most encoded images and bytes kept in the image cache
+const (
+	IMAGE_CACHE_MAX       = 512
+	IMAGE_CACHE_BYTES_MAX = 64 << 20
+)
+
+// Key of a cached image, the same text looks different with other options
+type imageKey struct {
+	Text string
+	Opts RenderOptions
+}
+
+// Cached encoded image
+type imageEntry struct {
+	Key  imageKey
+	Data []byte
+}
+
+// ImageCache keeps recently rendered PNG images, evicting the least recently used ones
+var ImageCache = struct {
+	sync.Mutex
+	List   *list.List
+	Map    map[imageKey]*list.Element
+	Bytes  int
+	Hits   int
+	Misses int
+}{
+	List: list.New(),
+	Map:  make(map[imageKey]*list.Element),
+}
+
+// Returns true if images with these options come out the same every time
+// Distorted images and the random font are meant to differ
+func cacheable(opts RenderOptions) bool {
+	return !opts.Distort && strings.ToLower(opts.Font) != RANDOM_FONT
+}
+
+// Returns a cached image for text and options, and whether there was one
+func getCachedImage(text string, opts RenderOptions) ([]byte, bool) {
+
+	ImageCache.Lock()
+	defer ImageCache.Unlock()
+
+	element, ok := ImageCache.Map[imageKey{text, opts}]
+	if !ok {
+		ImageCache.Misses++
+		return nil, false
+	}
+
+	ImageCache.Hits++
+	ImageCache.List.MoveToFront(element)
+	return element.Value.(*imageEntry).Data, true
+}
+
+// Adds an image to the cache, evicting the least recently used ones beyond the limits
+func putCachedImage(text string, opts RenderOptions, data []byte) {
+
+	if len(data) > IMAGE_CACHE_BYTES_MAX {
+		return
+	}
+
+	ImageCache.Lock()
+	defer ImageCache.Unlock()
+
+	key := imageKey{text, opts}
+	if element, ok := ImageCache.Map[key]; ok {
+		ImageCache.Bytes -= len(element.Value.(*imageEntry).Data)
+		ImageCache.List.Remove(element)
+	}
+
+	ImageCache.Map[key] = ImageCache.List.PushFront(&imageEntry{key, data})
+	ImageCache.Bytes += len(data)
+
+	for ImageCache.List.Len() > IMAGE_CACHE_MAX || ImageCache.Bytes > IMAGE_CACHE_BYTES_MAX {
+		oldest := ImageCache.List.Back()
+		entry := oldest.Value.(*imageEntry)
+		ImageCache.List.Remove(oldest)
+		delete(ImageCache.Map, entry.Key)
+		ImageCache.Bytes -= len(entry.Data)
+	}
+}
+
+// Empty the image cache, like after fonts changed
+func clearImageCache() {
+	ImageCache.Lock()
+	ImageCache.List.Init()
+	ImageCache.Map = make(map[imageKey]*list.Element)
+	ImageCache.Bytes = 0
+	ImageCache.Unlock()
+}
+
+// Returns a summary of image cache use
+func imageCacheStats() string {
+
+	ImageCache.Lock()
+	defer ImageCache.Unlock()
+
+	var ratio float64
+	if total := ImageCache.Hits + ImageCache.Misses; total > 0 {
+		ratio = float64(ImageCache.Hits) / float64(total) * 100
+	}
+
+	return fmt.Sprintf("Image cache: %d images, %.1f MB, %d hits, %d misses (%.1f%% hit rate)",
+		ImageCache.List.Len(), float64(ImageCache.Bytes)/(1<<20), ImageCache.Hits, ImageCache.Misses, ratio)
+}
+
+// Render the questions of decks as images to disk, timing how long rendering takes
+func renderCommand(args []string) int {
+
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	outDir := fs.String("o", "render", "output folder, gets a subfolder per deck")
+	fontName := fs.String("font", "", "font name from the fonts folder")
+	vertical := fs.Bool("vertical", false, "write questions vertically")
+	distort := fs.Bool("distort", false, "distort questions against OCR")
+	repeat := fs.Int("repeat", 1, "render every question this many times, to time cache hits")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s render [options] <deck>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || *repeat < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// Rendering can't do without the main font
+	if _, err := os.Stat(RESOURCES_FOLDER + fontFile); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Loading font:", err)
+		return 1
+	}
+	loadFont()
+	if len(*fontName) > 0 && !isFont(*fontName) {
+		fmt.Fprintf(os.Stderr, "ERROR, Unknown font '%s', available fonts: %s\n", *fontName, strings.Join(FontNames(), ", "))
+		return 1
+	}
+
+	if err := loadQuizList(); err != nil {
+		return 1
+	}
+
+	// Flags override deck settings like quiz options do
+	opts := make(map[string]string)
+	if len(*fontName) > 0 {
+		opts["font"] = *fontName
+	}
+	if *vertical {
+		opts["vertical"] = "on"
+	}
+	if *distort {
+		opts["distort"] = "on"
+	}
+
+	status := 0
+	for _, name := range fs.Args() {
+		quiz, err := LoadQuiz(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR,", err)
+			status = 1
+			continue
+		}
+
+		folder := filepath.Join(*outDir, name)
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Creating output folder:", err)
+			return 1
+		}
+
+		render := quizRenderOptions(quiz, opts)
+
+		var count, size int
+		var first, rest time.Duration
+		for i, card := range quiz.Deck {
+			if quiz.CardType(card) != "" {
+				continue
+			}
+
+			text, cardRender := card.Question, render
+			if len(card.Context) > 0 {
+				text, cardRender.Highlight = card.Context, card.Question
+			}
+
+			var buf *bytes.Buffer
+			for j := 0; j < *repeat; j++ {
+				start := time.Now()
+				buf = RenderImage(text, cardRender)
+				if j == 0 {
+					first += time.Since(start)
+				} else {
+					rest += time.Since(start)
+				}
+			}
+			if buf == nil {
+				fmt.Fprintf(os.Stderr, "ERROR, Rendering card %d of '%s' failed\n", i+1, name)
+				status = 1
+				continue
+			}
+
+			count++
+			size += buf.Len()
+			if err := ioutil.WriteFile(filepath.Join(folder, fmt.Sprintf("%04d.png", i+1)), buf.Bytes(), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, "ERROR, Writing image:", err)
+				return 1
+			}
+		}
+
+		if count == 0 {
+			fmt.Printf("No text questions to render in '%s'\n", name)
+			continue
+		}
+		fmt.Printf("Rendered %d questions of '%s' to %s: %s total, %s per image, %.1f KB per image\n",
+			count, name, folder, first.Round(time.Millisecond), (first / time.Duration(count)).Round(time.Microsecond), float64(size)/float64(count)/1024)
+		if *repeat > 1 {
+			fmt.Printf("Repeated renders: %s per image\n", (rest / time.Duration(count*(*repeat-1))).Round(time.Microsecond))
+		}
+	}
+	fmt.Println(imageCacheStats())
+
+	return status
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestImageCache(t *testing.T) {
+
+	clearImageCache()
+	defer clearImageCache()
+
+	// The least recently used image goes first
+	for i := 0; i <= IMAGE_CACHE_MAX; i++ {
+		putCachedImage(fmt.Sprint(i), RenderOptions{}, []byte{byte(i)})
+		if i == 1 {
+			getCachedImage("0", RenderOptions{})
+		}
+	}
+	if _, ok := getCachedImage("1", RenderOptions{}); ok {
+		t.Error("Least recently used image was not evicted")
+	}
+	if data, ok := getCachedImage("0", RenderOptions{}); !ok || data[0] != 0 {
+		t.Error("Recently used image was evicted")
+	}
+	if _, ok := getCachedImage("0", RenderOptions{Vertical: true}); ok {
+		t.Error("Image with other options should not be found")
+	}
+	if ImageCache.List.Len() != IMAGE_CACHE_MAX || ImageCache.Bytes != IMAGE_CACHE_MAX {
+		t.Errorf("Cache holds %d images of %d bytes", ImageCache.List.Len(), ImageCache.Bytes)
+	}
+
+	// Rendering goes through the cache unless images are meant to differ
+	useTestFont(t)
+	hits, misses := ImageCache.Hits, ImageCache.Misses
+	first := RenderImage("cache", RenderOptions{}).String()
+	if second := RenderImage("cache", RenderOptions{}).String(); second != first {
+		t.Error("Cached image differs from the rendered one")
+	}
+	RenderImage("cache", RenderOptions{Distort: true})
+	if ImageCache.Hits != hits+1 || ImageCache.Misses != misses+1 {
+		t.Errorf("Rendering counted %d hits and %d misses", ImageCache.Hits-hits, ImageCache.Misses-misses)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+)
+
+// Largest rotation of a single glyph in degrees
+const DISTORT_ROTATION_MAX = 12.0
+
+// Wave warp amplitude and wavelength relative to the line height
+const (
+	DISTORT_WAVE_AMPLITUDE = 0.04
+	DISTORT_WAVE_LENGTH    = 2.5
+)
+
+// Noise dots per 1000 pixels of background
+const DISTORT_NOISE_DENSITY = 6
+
+// Strike lines drawn across every line of text
+const DISTORT_STRIKE_LINES = 2
+
+// Largest change of a colour channel through jitter
+const DISTORT_COLOUR_JITTER = 0x30
+
+// Returns the colour with every channel shifted randomly by up to the given amount
+func jitterColour(rnd *rand.Rand, c color.RGBA, amount int) color.RGBA {
+	jitter := func(v uint8) uint8 {
+		n := int(v) + rnd.Intn(2*amount+1) - amount
+		if n < 0 {
+			n = 0
+		} else if n > 0xFF {
+			n = 0xFF
+		}
+		return uint8(n)
+	}
+
+	return color.RGBA{jitter(c.R), jitter(c.G), jitter(c.B), c.A}
+}
+
+// Returns the glyph mask found at maskp rotated by angle radians around the centre of rectangle dr,
+// placed in destination coordinates
+func rotateMask(mask image.Image, maskp image.Point, dr image.Rectangle, angle float64) *image.Alpha {
+
+	w, h := dr.Dx(), dr.Dy()
+	cx, cy := float64(dr.Min.X)+float64(w)/2, float64(dr.Min.Y)+float64(h)/2
+	radius := int(math.Ceil(math.Hypot(float64(w), float64(h)) / 2))
+	out := image.NewAlpha(image.Rect(int(cx)-radius, int(cy)-radius, int(cx)+radius+1, int(cy)+radius+1))
+
+	// Alpha of the glyph at a pixel relative to its rectangle, the mask may hold other glyphs around it
+	at := func(x int, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		_, _, _, a := mask.At(maskp.X+x, maskp.Y+y).RGBA()
+		return float64(a >> 8)
+	}
+
+	sin, cos := math.Sincos(angle)
+	b := out.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Find the source position by rotating back, then sample bilinearly
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			sx := dx*cos + dy*sin + cx - float64(dr.Min.X) - 0.5
+			sy := -dx*sin + dy*cos + cy - float64(dr.Min.Y) - 0.5
+
+			x0, y0 := math.Floor(sx), math.Floor(sy)
+			fx, fy := sx-x0, sy-y0
+			ix, iy := int(x0), int(y0)
+			a := at(ix, iy)*(1-fx)*(1-fy) + at(ix+1, iy)*fx*(1-fy) + at(ix, iy+1)*(1-fx)*fy + at(ix+1, iy+1)*fx*fy
+			out.SetAlpha(x, y, color.Alpha{uint8(math.Round(a))})
+		}
+	}
+
+	return out
+}
+
+// Returns a copy of the image displaced along sine waves in both directions
+func waveWarp(rnd *rand.Rand, src *image.RGBA, amplitude float64, wavelength float64) *image.RGBA {
+
+	b := src.Bounds()
+	out := image.NewRGBA(b)
+	phaseX, phaseY := rnd.Float64()*2*math.Pi, rnd.Float64()*2*math.Pi
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		offsetX := amplitude * math.Sin(2*math.Pi*float64(y)/wavelength+phaseX)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			offsetY := amplitude * math.Sin(2*math.Pi*float64(x)/wavelength+phaseY)
+			out.SetRGBA(x, y, sampleRGBA(src, float64(x)+offsetX, float64(y)+offsetY))
+		}
+	}
+
+	return out
+}
+
+// Returns the bilinearly interpolated colour of the image at a position, clamped to its edges
+func sampleRGBA(img *image.RGBA, x float64, y float64) color.RGBA {
+
+	b := img.Bounds()
+	clamp := func(v int, min int, max int) int {
+		if v < min {
+			return min
+		} else if v >= max {
+			return max - 1
+		}
+		return v
+	}
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix0, iy0 := clamp(int(x0), b.Min.X, b.Max.X), clamp(int(y0), b.Min.Y, b.Max.Y)
+	ix1, iy1 := clamp(int(x0)+1, b.Min.X, b.Max.X), clamp(int(y0)+1, b.Min.Y, b.Max.Y)
+
+	c00, c10 := img.RGBAAt(ix0, iy0), img.RGBAAt(ix1, iy0)
+	c01, c11 := img.RGBAAt(ix0, iy1), img.RGBAAt(ix1, iy1)
+	mix := func(v00, v10, v01, v11 uint8) uint8 {
+		v := float64(v00)*(1-fx)*(1-fy) + float64(v10)*fx*(1-fy) + float64(v01)*(1-fx)*fy + float64(v11)*fx*fy
+		return uint8(math.Round(v))
+	}
+
+	return color.RGBA{
+		mix(c00.R, c10.R, c01.R, c11.R),
+		mix(c00.G, c10.G, c01.G, c11.G),
+		mix(c00.B, c10.B, c01.B, c11.B),
+		mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+// Sprinkle small dots in colours around the given one over the image
+func drawNoise(rnd *rand.Rand, img *image.RGBA, c color.RGBA) {
+
+	b := img.Bounds()
+	dots := b.Dx() * b.Dy() * DISTORT_NOISE_DENSITY / 1000
+	for i := 0; i < dots; i++ {
+		x, y := b.Min.X+rnd.Intn(b.Dx()), b.Min.Y+rnd.Intn(b.Dy())
+		size := 1 + rnd.Intn(2)
+		draw.Draw(img, image.Rect(x, y, x+size, y+size), image.NewUniform(jitterColour(rnd, c, DISTORT_COLOUR_JITTER)), image.ZP, draw.Over)
+	}
+}
+
+// Draw a thin, gently curving line across the whole image width around height y
+func drawStrikeLine(rnd *rand.Rand, img *image.RGBA, y int, thickness int, c color.RGBA) {
+
+	b := img.Bounds()
+	slope := (rnd.Float64() - 0.5) * float64(thickness) * 8 / float64(b.Dx())
+	curve := float64(thickness) * (1 + rnd.Float64())
+	phase := rnd.Float64() * 2 * math.Pi
+	src := image.NewUniform(c)
+
+	for x := b.Min.X; x < b.Max.X; x++ {
+		cy := float64(y) + slope*float64(x-b.Min.X) + curve*math.Sin(float64(x)/float64(b.Dx())*2*math.Pi+phase)
+		top := int(math.Round(cy)) - thickness/2
+		draw.Draw(img, image.Rect(x, top, x+1, top+thickness), src, image.ZP, draw.Over)
+	}
+}
+
+// Apply strike lines through the text lines and warp the finished image
+func distortImage(rnd *rand.Rand, img *image.RGBA, baselines []int, lineHeight int, c color.RGBA) *image.RGBA {
+
+	thickness := lineHeight / 36
+	if thickness < 2 {
+		thickness = 2
+	}
+	for _, baseline := range baselines {
+		for i := 0; i < DISTORT_STRIKE_LINES; i++ {
+			// Somewhere through the body of the glyphs above the baseline
+			y := baseline - lineHeight/8 - rnd.Intn(lineHeight/2+1)
+			drawStrikeLine(rnd, img, y, thickness, jitterColour(rnd, c, DISTORT_COLOUR_JITTER))
+		}
+	}
+
+	return waveWarp(rnd, img, float64(lineHeight)*DISTORT_WAVE_AMPLITUDE, float64(lineHeight)*DISTORT_WAVE_LENGTH)
+}
+
+// Returns the distance the wave warp can move pixels, kept free around distorted images
+func distortMargin(lineHeight int) int {
+	return int(math.Ceil(float64(lineHeight) * DISTORT_WAVE_AMPLITUDE))
+}
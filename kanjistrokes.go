@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/golang/freetype/raster"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Folder of stroke order files in the format of KanjiVG, named by code point like 053e3.svg for 口
+// Only a few hand-drawn samples come bundled, see the README in the folder for getting the full set
+const STROKES_FOLDER = RESOURCES_FOLDER + "strokes/"
+
+// Size of the square KanjiVG draws in, and the stroke width and number size within it
+const (
+	STROKE_VIEWBOX     = 109
+	STROKE_WIDTH       = 3.0
+	STROKE_NUMBER_SIZE = 8.0
+)
+
+// Scale of the stroke order diagram and of the frames of the stroke by stroke sequence
+const (
+	STROKE_DIAGRAM_SCALE  = 3.0
+	STROKE_FRAME_SCALE    = 1.2
+	STROKE_FRAMES_PER_ROW = 5
+)
+
+// Line segments curves get flattened into
+const STROKE_CURVE_STEPS = 12
+
+// Commands and numbers of SVG path data
+var pathTokenRegex = regexp.MustCompile(`[A-Za-z]|[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+
+// A point in KanjiVG coordinates
+type strokePoint struct {
+	X float64
+	Y float64
+}
+
+// Stroke order file names by code point, leaving out KanjiVG variants like 053e3-Kaisho.svg
+var strokeFileRegex = regexp.MustCompile(`^[0-9a-f]{5}\.svg$`)
+
+// Returns how many kanji have a stroke order file
+func strokeCoverage() int {
+
+	files, err := ioutil.ReadDir(STROKES_FOLDER)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, file := range files {
+		if strokeFileRegex.MatchString(file.Name()) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Read the strokes of a kanji from its stroke order file, as lines through points in order of writing
+// Most kanji have no file, which returns no strokes rather than an error
+func loadStrokes(kanji rune) ([][]strokePoint, error) {
+
+	file, err := ioutil.ReadFile(fmt.Sprintf("%s%05x.svg", STROKES_FOLDER, kanji))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	strokes, err := parseStrokes(file)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing strokes of '%c': %s", kanji, err)
+	}
+
+	return strokes, nil
+}
+
+// Returns the strokes of a KanjiVG file, one per path element in the order they appear
+func parseStrokes(data []byte) ([][]strokePoint, error) {
+
+	var strokes [][]strokePoint
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "path" {
+			continue
+		}
+		for _, attr := range element.Attr {
+			if attr.Name.Local != "d" {
+				continue
+			}
+			points, err := parsePathData(attr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("Stroke %d: %s", len(strokes)+1, err)
+			}
+			strokes = append(strokes, points)
+		}
+	}
+
+	if len(strokes) == 0 {
+		return nil, fmt.Errorf("No strokes found")
+	}
+
+	return strokes, nil
+}
+
+// Returns the points of SVG path data, with curves flattened into line segments
+// Covers the commands KanjiVG uses: moves, lines and cubic curves, absolute or relative
+func parsePathData(d string) ([]strokePoint, error) {
+
+	tokens := pathTokenRegex.FindAllString(d, -1)
+	var points []strokePoint
+	var cur, start, ctrl strokePoint
+	var command byte
+
+	// Read the next n numbers following a command
+	next := func(n int) ([]float64, error) {
+		if len(tokens) < n {
+			return nil, fmt.Errorf("Command %c is missing numbers", command)
+		}
+		args := make([]float64, n)
+		for i := range args {
+			var err error
+			if args[i], err = strconv.ParseFloat(tokens[i], 64); err != nil {
+				return nil, fmt.Errorf("Command %c is missing numbers", command)
+			}
+		}
+		tokens = tokens[n:]
+		return args, nil
+	}
+
+	// Make a point absolute for relative commands
+	at := func(x, y float64) strokePoint {
+		if command >= 'a' {
+			return strokePoint{cur.X + x, cur.Y + y}
+		}
+		return strokePoint{x, y}
+	}
+
+	curve := func(c1, c2, end strokePoint) {
+		for i := 1; i <= STROKE_CURVE_STEPS; i++ {
+			t := float64(i) / STROKE_CURVE_STEPS
+			u := 1 - t
+			points = append(points, strokePoint{
+				u*u*u*cur.X + 3*u*u*t*c1.X + 3*u*t*t*c2.X + t*t*t*end.X,
+				u*u*u*cur.Y + 3*u*u*t*c1.Y + 3*u*t*t*c2.Y + t*t*t*end.Y,
+			})
+		}
+		ctrl, cur = c2, end
+	}
+
+	for len(tokens) > 0 {
+		if c := tokens[0][0]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			command = c
+			tokens = tokens[1:]
+			if command == 'Z' || command == 'z' {
+				points = append(points, start)
+				cur = start
+				continue
+			}
+		} else if command == 0 {
+			return nil, fmt.Errorf("Path data must start with a command")
+		}
+
+		switch command {
+		case 'M', 'm':
+			args, err := next(2)
+			if err != nil {
+				return nil, err
+			}
+			cur = at(args[0], args[1])
+			start, ctrl = cur, cur
+			points = append(points, cur)
+			// Further pairs draw lines
+			if command == 'M' {
+				command = 'L'
+			} else {
+				command = 'l'
+			}
+		case 'L', 'l':
+			args, err := next(2)
+			if err != nil {
+				return nil, err
+			}
+			cur = at(args[0], args[1])
+			ctrl = cur
+			points = append(points, cur)
+		case 'H', 'h', 'V', 'v':
+			args, err := next(1)
+			if err != nil {
+				return nil, err
+			}
+			switch command {
+			case 'H':
+				cur.X = args[0]
+			case 'h':
+				cur.X += args[0]
+			case 'V':
+				cur.Y = args[0]
+			case 'v':
+				cur.Y += args[0]
+			}
+			ctrl = cur
+			points = append(points, cur)
+		case 'C', 'c':
+			args, err := next(6)
+			if err != nil {
+				return nil, err
+			}
+			curve(at(args[0], args[1]), at(args[2], args[3]), at(args[4], args[5]))
+		case 'S', 's':
+			args, err := next(4)
+			if err != nil {
+				return nil, err
+			}
+			// The first control point mirrors the last one of the curve before
+			c1 := strokePoint{2*cur.X - ctrl.X, 2*cur.Y - ctrl.Y}
+			curve(c1, at(args[0], args[1]), at(args[2], args[3]))
+		default:
+			return nil, fmt.Errorf("Unsupported path command %c", command)
+		}
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("Empty path")
+	}
+
+	return points, nil
+}
+
+// Generate a PNG image reader with the stroke order of a kanji, as numbered diagram or frame by frame
+// Returns nil without error for kanji without stroke order file
+func RenderStrokeOrder(kanji rune, frames bool, theme Theme) (*bytes.Buffer, error) {
+
+	strokes, err := loadStrokes(kanji)
+	if strokes == nil || err != nil {
+		return nil, err
+	}
+
+	colours := theme.Palette()
+	if theme.Transparent {
+		colours.Background = color.RGBA{}
+	}
+
+	var img *image.RGBA
+	if frames {
+		img = drawStrokeFrames(strokes, colours)
+	} else {
+		img = drawStrokeDiagram(strokes, colours)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+// Draw all strokes with their numbers next to where they start
+func drawStrokeDiagram(strokes [][]strokePoint, colours Palette) *image.RGBA {
+
+	size := int(STROKE_VIEWBOX * STROKE_DIAGRAM_SCALE)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(colours.Background), image.ZP, draw.Src)
+
+	for _, stroke := range strokes {
+		drawStroke(img, stroke, STROKE_DIAGRAM_SCALE, image.ZP, colours.Foreground)
+	}
+
+	// Numbers only get drawn with a font to draw them in
+	if fontTtf == nil {
+		return img
+	}
+	face := truetype.NewFace(fontTtf, &truetype.Options{Size: STROKE_NUMBER_SIZE * STROKE_DIAGRAM_SCALE * 72 / fontDpi, DPI: fontDpi})
+	for i, stroke := range strokes {
+		number := strconv.Itoa(i + 1)
+		pos := numberPosition(stroke)
+		width := font.MeasureString(face, number)
+		drawer := font.Drawer{Dst: img, Src: image.NewUniform(colours.Highlight), Face: face}
+		drawer.Dot = fixed.Point26_6{
+			X: fixed.Int26_6(pos.X*STROKE_DIAGRAM_SCALE*64) - width/2,
+			Y: fixed.Int26_6((pos.Y + STROKE_NUMBER_SIZE*0.35) * STROKE_DIAGRAM_SCALE * 64),
+		}
+		drawer.DrawString(number)
+	}
+
+	return img
+}
+
+// Returns where the number of a stroke goes, a little before its start against the direction it is written in
+func numberPosition(stroke []strokePoint) strokePoint {
+
+	first := stroke[0]
+	var dx, dy float64
+	for _, p := range stroke[1:] {
+		if dx, dy = p.X-first.X, p.Y-first.Y; math.Hypot(dx, dy) > 1 {
+			break
+		}
+	}
+	pos := first
+	if length := math.Hypot(dx, dy); length > 0 {
+		pos.X -= dx / length * STROKE_NUMBER_SIZE * 0.8
+		pos.Y -= dy / length * STROKE_NUMBER_SIZE * 0.8
+	}
+
+	// Keep numbers inside the diagram
+	clamp := func(v float64) float64 {
+		return math.Max(STROKE_NUMBER_SIZE/2, math.Min(STROKE_VIEWBOX-STROKE_NUMBER_SIZE/2, v))
+	}
+
+	return strokePoint{clamp(pos.X), clamp(pos.Y)}
+}
+
+// Draw the kanji stroke by stroke in a grid of frames, with the newest stroke of every frame in highlight colour
+// Strokes still to come are drawn faintly, to show where they go
+func drawStrokeFrames(strokes [][]strokePoint, colours Palette) *image.RGBA {
+
+	size := int(math.Round(STROKE_VIEWBOX * STROKE_FRAME_SCALE))
+	columns := minint(len(strokes), STROKE_FRAMES_PER_ROW)
+	rows := (len(strokes) + columns - 1) / columns
+	img := image.NewRGBA(image.Rect(0, 0, columns*size+columns-1, rows*size+rows-1))
+
+	// Frames get separated by faint lines
+	faint := blendColour(colours.Background, colours.Foreground, 0.15)
+	draw.Draw(img, img.Bounds(), image.NewUniform(faint), image.ZP, draw.Src)
+
+	for i := range strokes {
+		offset := image.Pt(i%columns*(size+1), i/columns*(size+1))
+		draw.Draw(img, image.Rectangle{offset, offset.Add(image.Pt(size, size))}, image.NewUniform(colours.Background), image.ZP, draw.Src)
+
+		for j, stroke := range strokes {
+			c := colours.Foreground
+			if j == i {
+				c = colours.Highlight
+			} else if j > i {
+				c = faint
+			}
+			drawStroke(img, stroke, STROKE_FRAME_SCALE, offset, c)
+		}
+	}
+
+	return img
+}
+
+// Draw a stroke scaled up from KanjiVG coordinates onto an image, moved by offset
+func drawStroke(img *image.RGBA, stroke []strokePoint, scale float64, offset image.Point, c color.RGBA) {
+
+	var path raster.Path
+	var last fixed.Point26_6
+	for i, p := range stroke {
+		point := fixed.Point26_6{
+			X: fixed.Int26_6((p.X*scale + float64(offset.X)) * 64),
+			Y: fixed.Int26_6((p.Y*scale + float64(offset.Y)) * 64),
+		}
+		if i == 0 {
+			path.Start(point)
+		} else if point != last {
+			// Repeated points have no direction to stroke along
+			path.Add1(point)
+		}
+		last = point
+	}
+
+	b := img.Bounds()
+	rasterizer := raster.NewRasterizer(b.Max.X, b.Max.Y)
+	raster.Stroke(rasterizer, path, fixed.Int26_6(STROKE_WIDTH*scale*64), raster.RoundCapper, raster.RoundJoiner)
+	painter := raster.NewRGBAPainter(img)
+	painter.SetColor(c)
+	rasterizer.Rasterize(painter)
+}
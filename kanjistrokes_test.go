@@ -0,0 +1,142 @@
+package main
+
+import (
+	"image/png"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePathData(t *testing.T) {
+
+	tests := []struct {
+		d        string
+		expected []strokePoint
+	}{
+		{"M10,20L30,40", []strokePoint{{10, 20}, {30, 40}}},
+		{"m10 20 5-5 h10 v.5", []strokePoint{{10, 20}, {15, 15}, {25, 15}, {25, 15.5}}},
+		{"M10,20H30V40z", []strokePoint{{10, 20}, {30, 20}, {30, 40}, {10, 20}}},
+		{"M1e1,2e1l1.5.5", []strokePoint{{10, 20}, {11.5, 20.5}}},
+	}
+
+	for _, test := range tests {
+		points, err := parsePathData(test.d)
+		if err != nil {
+			t.Errorf("Parsing %q failed: %v", test.d, err)
+		} else if !cmp.Equal(points, test.expected) {
+			t.Errorf("Parsing %q gave %v, expected %v", test.d, points, test.expected)
+		}
+	}
+
+	// Curves end where they should, with smooth ones mirroring the control point before
+	points, err := parsePathData("M0,0c0,10,10,10,10,0s10-10,10,0C30,10,40,10,40,0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1+3*STROKE_CURVE_STEPS {
+		t.Errorf("Curves flattened into %d points", len(points))
+	}
+	for i, expected := range []strokePoint{{10, 0}, {20, 0}, {40, 0}} {
+		if p := points[(i+1)*STROKE_CURVE_STEPS]; p != expected {
+			t.Errorf("Curve %d ends at %v, expected %v", i+1, p, expected)
+		}
+	}
+	if mid := points[STROKE_CURVE_STEPS+STROKE_CURVE_STEPS/2]; mid.Y >= 0 {
+		t.Errorf("Smooth curve bends the wrong way through %v", mid)
+	}
+
+	for _, d := range []string{"", "10,20", "M10", "M10,20Q1,2,3,4", "M10,20C1,2,3"} {
+		if _, err := parsePathData(d); err == nil {
+			t.Errorf("Parsing %q should fail", d)
+		}
+	}
+}
+
+func TestBundledStrokes(t *testing.T) {
+
+	files, err := ioutil.ReadDir(STROKES_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		// KanjiVG variants like 053e3-Kaisho.svg go unused
+		if !strings.HasSuffix(file.Name(), ".svg") || strings.Contains(file.Name(), "-") {
+			continue
+		}
+		code, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), ".svg"), 16, 32)
+		if err != nil || len(file.Name()) != len("00000.svg") {
+			t.Errorf("Stroke order file %s is not named by code point", file.Name())
+			continue
+		}
+		if !strokeFileRegex.MatchString(file.Name()) {
+			t.Errorf("Stroke order file %s doesn't count towards coverage", file.Name())
+		}
+		strokes, err := loadStrokes(rune(code))
+		if err != nil {
+			t.Errorf("Loading %s failed: %v", file.Name(), err)
+			continue
+		}
+		for i, stroke := range strokes {
+			for _, p := range stroke {
+				if p.X < 0 || p.Y < 0 || p.X > STROKE_VIEWBOX || p.Y > STROKE_VIEWBOX {
+					t.Errorf("Stroke %d of %c leaves the diagram at %v", i+1, rune(code), p)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRenderStrokeOrder(t *testing.T) {
+
+	useTestFont(t)
+
+	// Kanji without stroke order file quietly come without diagram
+	if buf, err := RenderStrokeOrder('𠀋', false, Theme{}); buf != nil || err != nil {
+		t.Errorf("Drawing a kanji without stroke order file gave %v", err)
+	}
+
+	buf, err := RenderStrokeOrder('口', false, Theme{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagram, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := int(STROKE_VIEWBOX * STROKE_DIAGRAM_SCALE); diagram.Bounds().Dx() != size || diagram.Bounds().Dy() != size {
+		t.Errorf("Diagram has size %v, expected %d square", diagram.Bounds(), size)
+	}
+
+	// Three strokes make three frames in a row, every one with a stroke in highlight colour
+	buf, err = RenderStrokeOrder('口', true, Theme{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int(math.Round(STROKE_VIEWBOX * STROKE_FRAME_SCALE))
+	if frames.Bounds().Dx() != 3*size+2 || frames.Bounds().Dy() != size {
+		t.Fatalf("Frames have size %v, expected three frames of %d", frames.Bounds(), size)
+	}
+	for i := 0; i < 3; i++ {
+		var red int
+		for y := 0; y < size; y++ {
+			for x := i * (size + 1); x < i*(size+1)+size; x++ {
+				if r, g, _, _ := frames.At(x, y).RGBA(); r > g+0x4000 {
+					red++
+				}
+			}
+		}
+		if red == 0 {
+			t.Errorf("Frame %d has no stroke in highlight colour", i+1)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -63,7 +62,6 @@ func init() {
 	}()
 
 	flag.StringVar(&Token, "t", "", "Bot Token")
-	flag.Parse()
 
 	// New seed for random in order to shuffle properly
 	rand.Seed(time.Now().UnixNano())
@@ -92,9 +90,18 @@ func init() {
 
 func main() {
 
+	// Parse here rather than in init, so test binaries can use their own flags
+	flag.Parse()
+
+	// Run offline subcommands without connecting to Discord
+	if flag.NArg() > 0 {
+		os.Exit(runSubcommand(flag.Args()))
+	}
+
 	// Make sure we start with a token supplied
 	if len(Token) == 0 {
 		flag.Usage()
+		subcommandUsage()
 		return
 	}
 
@@ -124,6 +131,9 @@ func main() {
 	// Register the messageCreate func as a callback for MessageCreate events
 	session.AddHandler(messageCreate)
 
+	// Reload quiz files as they are edited
+	go watchQuizzes(session)
+
 	// Wait here until CTRL-C or other term signal is received
 	log.Println("NOTICE, Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
@@ -175,7 +185,7 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			showList(s, m)
 		case "kanji", "k":
 			if len(input) >= 2 {
-				err := sendKanjiInfo(s, m.ChannelID, input[1])
+				err := sendKanjiInfo(s, m.ChannelID, input[1], len(input) >= 3 && input[2] == "frames", userTheme(s, m.ChannelID, m.Author.ID))
 				if err != nil {
 					msgSend(s, m.ChannelID, "Error: "+err.Error())
 				}
@@ -223,17 +233,48 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			}
 		case "reload":
 			if m.Author.ID == Settings.Owner.ID {
-				if err := loadQuizList(); err == nil {
-					showList(s, m)
-				} else {
+				if err := loadQuizList(); err != nil {
 					msgSend(s, m.ChannelID, "Error: Failed to load quiz list!")
+					break
 				}
+
+				// Read all decks again, listing those that failed
+				if errs := reloadDecks(); len(errs) > 0 {
+					var msg string
+					for _, err := range errs {
+						msg += err.Error() + "\n"
+					}
+					msgSend(s, m.ChannelID, fmt.Sprintf("Error: Failed to load some quizzes: ```%s```", truncate(msg, 1900)))
+				}
+				showList(s, m)
 			} else {
 				msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
 			}
 		case "draw":
 			if len(input) >= 2 {
-				imgSend(s, m.ChannelID, strings.Replace(m.Content[len(input[0])+1:], "\\n", "\n", -1))
+				drawCommand(s, m, m.Content[len(input[0])+1:])
+			}
+		case "theme":
+			themeCommand(s, m, input[1:])
+		case "changes":
+			if len(input) >= 2 {
+				sendChanges(s, m.ChannelID, input[1])
+			} else {
+				msgSend(s, m.ChannelID, fmt.Sprintf("Usage: `%schanges <deck>`", CMD_PREFIX))
+			}
+		case "export":
+			if len(input) >= 2 {
+				format := "apkg"
+				if len(input) >= 3 {
+					format = input[2]
+				}
+				if err := sendExport(s, m, input[1], format); err != nil {
+					msgSend(s, m.ChannelID, "Error: "+err.Error())
+				} else {
+					msgSend(s, m.ChannelID, "Export sent by Direct Message!")
+				}
+			} else {
+				msgSend(s, m.ChannelID, fmt.Sprintf("Usage: `%sexport <deck|review> [apkg/csv/tsv]`", CMD_PREFIX))
 			}
 		case "output":
 			// Sets Gauntlet score output channel
@@ -243,6 +284,19 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			} else {
 				msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
 			}
+		case "distort":
+			// Sets quiz speeds with distorted question images
+			if m.Author.ID == Settings.Owner.ID {
+				distortCommand(s, m.ChannelID, input[1:])
+			} else {
+				msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
+			}
+		case "cache":
+			if m.Author.ID == Settings.Owner.ID {
+				msgSend(s, m.ChannelID, imageCacheStats())
+			} else {
+				msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
+			}
 		case "ongoing":
 			if m.Author.ID == Settings.Owner.ID {
 				msgOngoing(s, m.ChannelID)
@@ -263,10 +317,13 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			if !isBotChannel(s, m.ChannelID) {
 				break
 			}
-			if len(input) == 2 {
-				go runQuiz(s, m.ChannelID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1])
-			} else if len(input) == 3 {
-				go runQuiz(s, m.ChannelID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1])
+			if len(input) >= 2 {
+				winLimit, opts := parseQuizArgs(input[2:])
+				if !checkFontOption(s, m.ChannelID, opts) || !checkOrderOption(s, m.ChannelID, opts) {
+					break
+				}
+				distortQuiz(s, m.ChannelID, command, opts)
+				go runQuiz(s, m.ChannelID, input[1], winLimit, opts, Settings.Speed[command][0], Settings.Speed[command][1])
 			} else {
 				// Show if no quiz specified
 				showList(s, m)
@@ -275,10 +332,13 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			if !isBotChannel(s, m.ChannelID) {
 				break
 			}
-			if len(input) == 2 {
-				go runMultiQuiz(s, m.ChannelID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1])
-			} else if len(input) == 3 {
-				go runMultiQuiz(s, m.ChannelID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1])
+			if len(input) >= 2 {
+				winLimit, opts := parseQuizArgs(input[2:])
+				if !checkFontOption(s, m.ChannelID, opts) || !checkOrderOption(s, m.ChannelID, opts) {
+					break
+				}
+				distortQuiz(s, m.ChannelID, command, opts)
+				go runMultiQuiz(s, m.ChannelID, input[1], winLimit, opts, Settings.Speed[command][0], Settings.Speed[command][1])
 			} else {
 				// Show if no quiz specified
 				showList(s, m)
@@ -299,8 +359,13 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			if !isBotChannel(s, m.ChannelID) {
 				break
 			}
-			if len(input) == 2 {
-				go runGauntlet(s, m, input[1])
+			if len(input) >= 2 {
+				_, opts := parseQuizArgs(input[2:])
+				if !checkFontOption(s, m.ChannelID, opts) || !checkOrderOption(s, m.ChannelID, opts) {
+					break
+				}
+				distortQuiz(s, m.ChannelID, command, opts)
+				go runGauntlet(s, m, input[1], opts)
 			} else {
 				// Show if no quiz specified
 				showHelp(s, m)
@@ -310,11 +375,26 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 
 }
 
-// Show quiz list message in channel
+// Show quiz list message in channel, grouped by category
 func showList(s *discordgo.Session, m *discordgo.MessageCreate) {
-	quizlist := GetQuizlist()
-	sort.Strings(quizlist)
-	msgSend(s, m.ChannelID, fmt.Sprintf("Available quizzes: ```%s```\nUse `%squiz <deck> [optional max score]` to start or `%shelp` for more detailed information.", strings.Join(quizlist, ", "), CMD_PREFIX, CMD_PREFIX))
+
+	var msg string
+	for _, category := range QuizCategories {
+		quizlist := GetQuizlistBy(func(info QuizInfo) bool { return info.CategoryName() == category && !info.Hidden })
+		if len(quizlist) == 0 {
+			continue
+		}
+
+		for i, name := range quizlist {
+			info, _ := GetQuizInfo(name)
+			if labels := info.Labels(); len(labels) > 0 {
+				quizlist[i] = fmt.Sprintf("%s (%s)", name, strings.Join(labels, ", "))
+			}
+		}
+		msg += fmt.Sprintf("%s: %s\n", category, strings.Join(quizlist, ", "))
+	}
+
+	msgSend(s, m.ChannelID, fmt.Sprintf("Available quizzes: ```%s```\nUse `%squiz <deck> [optional max score]` to start or `%shelp` for more detailed information.", msg, CMD_PREFIX, CMD_PREFIX))
 }
 
 // Show bot help message in channel
@@ -328,34 +408,39 @@ func showHelp(s *discordgo.Session, m *discordgo.MessageCreate) {
 		Inline: false,
 	})
 
-	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Educational decks",
-		Value:  "n0, n1, n2, n3, n4, n5, n5_adv, jlpt_blob, kanken_1k, kanken_j1k, kanken_2k, kanken_j2k, kanken_3k, kanken_4k, kanken_5k, kanken_6-10k, kanken_blob, common, jouyou, kklc, eee, jjj, esyne, jsynj",
-		Inline: false,
-	})
+	// Deck lists are generated from the Quiz List metadata
+	for _, category := range QuizCategories {
+		quizlist := GetQuizlistBy(func(info QuizInfo) bool { return info.CategoryName() == category && !info.NSFW && !info.Hidden })
+		if len(quizlist) == 0 {
+			continue
+		}
 
-	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Difficult decks",
-		Value:  "n0, kanken_1k, kanken_j1k, kanken_2k, quirky, kklc, tough, ee, jj",
-		Inline: false,
-	})
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("%s decks", category),
+			Value:  truncate(strings.Join(quizlist, ", "), DISCORD_FIELD_MAX),
+			Inline: false,
+		})
+	}
 
-	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Name decks",
-		Value:  "namae, myouji, onago, prefectures, stations",
-		Inline: false,
-	})
+	difficult := GetQuizlistBy(func(info QuizInfo) bool { return info.Difficulty == "hard" && !info.NSFW && !info.Hidden })
+	if len(difficult) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Difficult decks",
+			Value:  truncate(strings.Join(difficult, ", "), DISCORD_FIELD_MAX),
+			Inline: false,
+		})
+	}
 
 	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Various other decks",
-		Value:  "esyn, jsyn, numbers, honyaku, yojijukugo, images, obscure, jukujikun, places, tokyo, niconico, kirakira, radicals, r18",
+		Name:   "Kanji lookups",
+		Value:  fmt.Sprintf("Type `%sk <kanji>` for kanji information, and `%sk <kanji> frames` for its strokes one by one.\nStroke order is only drawn for the %d kanji with stroke order data.", CMD_PREFIX, CMD_PREFIX, strokeCoverage()),
 		Inline: false,
 	})
 
 	fields = append(fields, &discordgo.MessageEmbedField{
 		Name: "Alternative game modes",
 		Value: fmt.Sprintf(
-			"`%smad/fast/quiz/mild/slow <deck>` for 0/1/2/3/5 second answer windows.\n`%smulti <deck>` for scoring on multiple answers to the same question.\n`%sflash <deck>` for no pause between questions.\n`%sgauntlet <deck>` in PM for a kanji time trial.\n`%sscramble [easy/normal/hard/insane]` for an English Word Scramble quiz.",
+			"`%smad/fast/quiz/mild/slow <deck>` for 0/1/2/3/5 second answer windows.\n`%smulti <deck>` for scoring on multiple answers to the same question.\n`%sflash <deck>` for no pause between questions.\n`%sgauntlet <deck>` in PM for a kanji time trial.\n`%sscramble [easy/normal/hard/insane]` for an English Word Scramble quiz.\nAdd `order=sequential/reverse/chunks/hardest` to change the card order.",
 			CMD_PREFIX,
 			CMD_PREFIX,
 			CMD_PREFIX,
@@ -454,6 +539,16 @@ func getReview(quizChannel string) Quiz {
 	return result
 }
 
+// Get a copy of the review quiz for given channel, leaving it in place
+func peekReview(quizChannel string) Quiz {
+
+	Review.RLock()
+	result := copyQuiz(Review.ChannelID[quizChannel])
+	Review.RUnlock()
+
+	return result
+}
+
 // Insert quiz into Review for given channel
 func putReview(quizChannel string, quiz Quiz) {
 	Review.Lock()
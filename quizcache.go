@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// How often the quizzes folder is checked for changed deck files
+const QUIZ_WATCH_INTERVAL = 5 * time.Second
+
+// DeckCache keeps decoded quiz files in memory, keyed by quiz name
+var DeckCache struct {
+	sync.RWMutex
+	Map map[string]cachedDeck
+}
+
+// Decoded quiz file along with the file state it was read from
+type cachedDeck struct {
+	File    string
+	ModTime time.Time
+	Size    int64
+	Quiz    Quiz
+}
+
+// Returns true if the cache entry was read from the given file in its current state
+func (cd cachedDeck) Fresh(filename string, fi os.FileInfo) bool {
+	return cd.File == filename && cd.ModTime.Equal(fi.ModTime()) && cd.Size == fi.Size()
+}
+
+// Returns a quiz file from the cache, decoding it from disk first if it changed since last read
+func cachedQuizFile(name string, filename string) (Quiz, error) {
+
+	fi, err := os.Stat(QUIZ_FOLDER + filename)
+	if os.IsNotExist(err) {
+		return Quiz{}, &MissingFileError{Name: name, File: filename}
+	} else if err != nil {
+		return Quiz{}, err
+	}
+
+	DeckCache.RLock()
+	entry, ok := DeckCache.Map[name]
+	DeckCache.RUnlock()
+
+	if !ok || !entry.Fresh(filename, fi) {
+		data, err := ioutil.ReadFile(QUIZ_FOLDER + filename)
+		if err != nil {
+			return Quiz{}, err
+		}
+		quiz, err := decodeQuiz(filename, bytes.NewReader(data))
+		if err != nil {
+			return Quiz{}, newParseError(name, filename, data, err)
+		}
+
+		entry = cachedDeck{File: filename, ModTime: fi.ModTime(), Size: fi.Size(), Quiz: quiz}
+
+		// Keep track of what changed since the version cached now, unless a concurrent load got there first
+		DeckCache.Lock()
+		if DeckCache.Map == nil {
+			DeckCache.Map = make(map[string]cachedDeck)
+		}
+		if previous, ok := DeckCache.Map[name]; !ok || !previous.Fresh(filename, fi) {
+			if ok {
+				if changes := diffDecks(previous.Quiz, quiz); len(changes) > 0 {
+					recordChanges(name, previous.ModTime, changes)
+				}
+			}
+			DeckCache.Map[name] = entry
+		}
+		DeckCache.Unlock()
+	}
+
+	// Hand out a deck of its own, since callers shuffle and extend it in place
+	quiz := entry.Quiz
+	quiz.Deck = append([]Card(nil), entry.Quiz.Deck...)
+
+	return quiz, nil
+}
+
+// Read every quiz in the Quiz List, refreshing changed files in the cache
+// Returns the quizzes that failed to load
+func reloadDecks() []error {
+
+	quizlist := GetQuizlist()
+	sort.Strings(quizlist)
+
+	var errs []error
+	for _, name := range quizlist {
+		if _, err := readQuizFile(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", name, err))
+		}
+	}
+
+	return errs
+}
+
+// Poll the Quiz List and quiz files for changes, reloading them as they are edited
+// Files that fail to load are reported to the bot owner
+func watchQuizzes(s *discordgo.Session) {
+
+	// Cache every deck first, so changes get recorded from the first edit on
+	for _, err := range reloadDecks() {
+		log.Println("ERROR, Loading quiz:", err)
+	}
+
+	seen := make(map[string]time.Time)
+
+	// Returns true if the file was modified since the last check
+	changed := func(path string) bool {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return false
+		}
+
+		last, ok := seen[path]
+		seen[path] = fi.ModTime()
+
+		return ok && !last.Equal(fi.ModTime())
+	}
+
+	for {
+		if changed(RESOURCES_FOLDER + "quizlist.json") {
+			log.Println("NOTICE, Quiz List changed, reloading")
+			if err := loadQuizList(); err != nil {
+				reportOwner(s, fmt.Sprintf("Failed to reload quiz list: %s", err))
+			}
+		}
+
+		var reloaded []string
+		for _, name := range GetQuizlist() {
+			info, _ := GetQuizInfo(name)
+			if !changed(QUIZ_FOLDER + info.File) {
+				continue
+			}
+
+			if _, err := readQuizFile(name); err != nil {
+				reportOwner(s, fmt.Sprintf("Failed to reload quiz '%s': %s", name, err))
+			} else {
+				reloaded = append(reloaded, name)
+			}
+		}
+		if len(reloaded) > 0 {
+			sort.Strings(reloaded)
+			log.Printf("NOTICE, Reloaded changed quizzes: %s\n", strings.Join(reloaded, ", "))
+		}
+
+		time.Sleep(QUIZ_WATCH_INTERVAL)
+	}
+}
+
+// Tell the channel why a quiz failed to load, reporting broken files to the owner as well
+func reportLoadError(s *discordgo.Session, cid string, err error) {
+
+	switch err.(type) {
+	case *MissingFileError, *ParseError, *IncludeError:
+		reportOwner(s, err.Error())
+	}
+
+	msgSend(s, cid, "Error: "+err.Error())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDeckCache(t *testing.T) {
+
+	name := "_cache_test"
+	filename := QUIZ_FOLDER + name + ".json"
+
+	loadQuizList()
+	Quizzes.Lock()
+	Quizzes.Map[name] = QuizInfo{File: name + ".json"}
+	Quizzes.Unlock()
+
+	// Start without anything cached or recorded by earlier runs
+	DeckCache.Lock()
+	delete(DeckCache.Map, name)
+	DeckCache.Unlock()
+	DeckChanges.Lock()
+	delete(DeckChanges.Map, name)
+	DeckChanges.Unlock()
+
+	write := func(data string) {
+		if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Remove(filename)
+
+	write(`{ "description": "Cache", "deck": [ { "question": "q1", "answers": [ "a" ] } ] }`)
+	quiz, err := readQuizFile(name)
+	if err != nil || len(quiz.Deck) != 1 {
+		t.Fatalf("Reading quiz failed: %v %+v", err, quiz)
+	}
+
+	// Changes to a returned deck must not leak into the cache
+	quiz.Deck[0].Question = "changed"
+	if cached, _ := readQuizFile(name); cached.Deck[0].Question != "q1" {
+		t.Errorf("Cached deck was modified through returned quiz: %+v", cached)
+	}
+
+	// Edited files are picked up again
+	write(`{ "description": "Cache", "deck": [ { "question": "q1", "answers": [ "a" ] }, { "question": "q2", "answers": [ "b" ] } ] }`)
+	if quiz, err := readQuizFile(name); err != nil || len(quiz.Deck) != 2 {
+		t.Errorf("Edited quiz was not reloaded: %v %+v", err, quiz)
+	}
+
+	// Reloads remember what changed
+	DeckChanges.RLock()
+	records := DeckChanges.Map[name]
+	DeckChanges.RUnlock()
+	if len(records) != 1 || len(records[0].Changes) != 1 || records[0].Changes[0].Question != "q2" {
+		t.Errorf("Reload changes were not recorded: %+v", records)
+	}
+
+	// Concurrent reloads of the same edit record it once
+	write(`{ "description": "Cache", "deck": [ { "question": "q2", "answers": [ "b" ] } ] }`)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readQuizFile(name)
+		}()
+	}
+	wg.Wait()
+	DeckChanges.RLock()
+	records = DeckChanges.Map[name]
+	DeckChanges.RUnlock()
+	if len(records) != 2 || len(records[1].Changes) != 1 || records[1].Changes[0].Question != "q1" {
+		t.Errorf("Concurrent reload changes were not recorded once: %+v", records)
+	}
+
+	// Broken files are reported instead of served empty
+	write(`{ "description": "Cache", "deck": [ `)
+	if _, err := readQuizFile(name); err == nil {
+		t.Error("Broken quiz file should fail to load")
+	}
+}
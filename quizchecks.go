@@ -0,0 +1,452 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Question types understood by the quiz loop, empty means rendered as image
+var QuizTypes = []string{"", "text", "url", "image"}
+
+// Longest accepted quiz timeout in seconds
+const QUIZ_TIMEOUT_MAX = 300
+
+// Widest rendered question line in pixels before the image gets unreadable in Discord,
+// as lines wrapped more than once get drawn too small
+const QUESTION_WIDTH_MAX = 2 * IMAGE_WIDTH_MAX
+
+// Most rendered question lines before the image gets unreadable in Discord
+const QUESTION_LINES_MAX = 10
+
+// Share of kana-only answers that makes a quiz count as a reading quiz
+const READING_QUIZ_RATIO = 0.9
+
+func init() {
+	registerValidator(emptyValidator{})
+	registerValidator(duplicateValidator{})
+	registerValidator(kanaDuplicateValidator{})
+	registerValidator(metadataValidator{})
+	registerValidator(typeValidator{})
+	registerValidator(timeoutValidator{})
+	registerValidator(orderValidator{})
+	registerValidator(imageAssetValidator{})
+	registerValidator(longQuestionValidator{})
+	registerValidator(glyphValidator{})
+	registerValidator(kanjiAnswerValidator{})
+	registerValidator(readingValidator{})
+}
+
+// Finds blank questions and answers, and cards without any answers
+type emptyValidator struct{}
+
+func (v emptyValidator) Name() string { return "empty" }
+
+func (v emptyValidator) Check(quiz Quiz) (issues []Issue) {
+	for i, card := range quiz.Deck {
+		if len(strings.TrimSpace(card.Question)) == 0 {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, "", "Found empty question in card %d", i+1))
+		}
+		if len(removeEmpty(card.Answers)) == 0 {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found card without answers"))
+		} else if len(removeEmpty(card.Answers)) < len(card.Answers) {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found empty answer"))
+		}
+	}
+
+	return
+}
+
+// Drops blank answers, and then cards left without a question or answers
+func (v emptyValidator) Fix(quiz Quiz) Quiz {
+	var deck []Card
+	for _, card := range quiz.Deck {
+		card.Answers = removeEmpty(card.Answers)
+		if len(strings.TrimSpace(card.Question)) > 0 && len(card.Answers) > 0 {
+			deck = append(deck, card)
+		}
+	}
+	quiz.Deck = deck
+
+	return quiz
+}
+
+// Finds duplicate questions and duplicate answers within a card
+type duplicateValidator struct{}
+
+func (v duplicateValidator) Name() string { return "duplicates" }
+
+func (v duplicateValidator) Check(quiz Quiz) (issues []Issue) {
+	seen := make(map[string]bool, len(quiz.Deck))
+	for _, card := range quiz.Deck {
+		if seen[card.Question] {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found duplicate question"))
+		}
+		seen[card.Question] = true
+
+		if dups := NewStringSet().AddAll(card.Answers...); dups != nil {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found duplicate answers: %s", strings.Join(dups, ", ")))
+		}
+	}
+
+	return
+}
+
+// Merges the answers, comments and tags of cards with the same question
+// Cards keep the position and other metadata of their first occurrence
+func (v duplicateValidator) Fix(quiz Quiz) Quiz {
+
+	// Use sets to hold merged card data temporarily
+	type mergedCard struct {
+		Card     Card
+		Answers  *SortedStringSet
+		Comments *SortedStringSet
+		Tags     *SortedStringSet
+	}
+
+	var order []string
+	merged := make(map[string]*mergedCard)
+	for _, card := range quiz.Deck {
+		m, ok := merged[card.Question]
+		if !ok {
+			m = &mergedCard{card, NewStringSet(), NewStringSet(), NewStringSet()}
+			merged[card.Question] = m
+			order = append(order, card.Question)
+		}
+
+		for _, answer := range card.Answers {
+			m.Answers.Add(answer)
+		}
+		if len(card.Comment) > 0 {
+			m.Comments.Add(card.Comment)
+		}
+		for _, tag := range card.Tags {
+			m.Tags.Add(tag)
+		}
+	}
+
+	// Populate quiz deck with fixed cards, keeping all deck level settings as they were
+	quiz.Deck = make([]Card, len(order))
+	for i, question := range order {
+		m := merged[question]
+		card := m.Card
+		card.Answers = m.Answers.Values()
+		card.Comment = strings.Join(m.Comments.Values(), "\n")
+		card.Tags = nil
+		if !m.Tags.IsEmpty() {
+			card.Tags = m.Tags.Values()
+		}
+		quiz.Deck[i] = card
+	}
+
+	return quiz
+}
+
+// Finds answers that only differ in katakana and hiragana, which the quiz treats as equal
+type kanaDuplicateValidator struct{}
+
+func (v kanaDuplicateValidator) Name() string { return "kana-duplicates" }
+
+func (v kanaDuplicateValidator) Check(quiz Quiz) (issues []Issue) {
+	for _, card := range quiz.Deck {
+		seen := make(map[string]string, len(card.Answers))
+		for _, answer := range card.Answers {
+			if first, ok := seen[k2h(answer)]; ok && first != answer {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found answers equal in hiragana: %s, %s", first, answer))
+			} else if !ok {
+				seen[k2h(answer)] = answer
+			}
+		}
+	}
+
+	return
+}
+
+// Keeps only the first of answers that are equal in hiragana
+func (v kanaDuplicateValidator) Fix(quiz Quiz) Quiz {
+	deck := make([]Card, len(quiz.Deck))
+	for i, card := range quiz.Deck {
+		var answers []string
+		for _, answer := range card.Answers {
+			if !isKanaDuplicate(answer, answers) {
+				answers = append(answers, answer)
+			}
+		}
+		card.Answers = answers
+		deck[i] = card
+	}
+	quiz.Deck = deck
+
+	return quiz
+}
+
+// Returns true if an answer differing only in kana type is among the given ones
+// Exact duplicates are left for the duplicate check to report
+func isKanaDuplicate(answer string, answers []string) bool {
+	for _, a := range answers {
+		if a != answer && k2h(a) == k2h(answer) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks that optional card metadata is within allowed ranges
+type metadataValidator struct{}
+
+func (v metadataValidator) Name() string { return "metadata" }
+
+func (v metadataValidator) Check(quiz Quiz) (issues []Issue) {
+	for _, card := range quiz.Deck {
+		if card.Difficulty < 0 || card.Difficulty > CARD_DIFFICULTY_MAX {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found difficulty out of range 0 (unset) or 1-%d (%d)", CARD_DIFFICULTY_MAX, card.Difficulty))
+		}
+		if card.Weight < 0 || card.Weight > CARD_WEIGHT_MAX {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found weight out of range 0-%.f (%g)", CARD_WEIGHT_MAX, card.Weight))
+		}
+		if len(removeEmpty(card.Tags)) < len(card.Tags) {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found empty tag"))
+		}
+	}
+
+	return
+}
+
+// Resets out of range values to their defaults
+func (v metadataValidator) Fix(quiz Quiz) Quiz {
+	fixed := quiz
+	fixed.Deck = append([]Card(nil), quiz.Deck...)
+	for i, card := range fixed.Deck {
+		if card.Difficulty < 0 || card.Difficulty > CARD_DIFFICULTY_MAX {
+			fixed.Deck[i].Difficulty = 0
+		}
+		if card.Weight < 0 || card.Weight > CARD_WEIGHT_MAX {
+			fixed.Deck[i].Weight = 0
+		}
+		if len(removeEmpty(card.Tags)) < len(card.Tags) {
+			fixed.Deck[i].Tags = removeEmpty(card.Tags)
+		}
+	}
+
+	return fixed
+}
+
+// Finds quiz and card types the quiz loop doesn't know
+type typeValidator struct{}
+
+func (v typeValidator) Name() string { return "types" }
+
+func (v typeValidator) Check(quiz Quiz) (issues []Issue) {
+	if !hasString(QuizTypes, quiz.Type) {
+		issues = append(issues, newIssue(v, SEVERITY_ERROR, "", "Found unknown quiz type '%s', expected one of: %s", quiz.Type, strings.Join(QuizTypes[1:], ", ")))
+	}
+	for _, card := range quiz.Deck {
+		if !hasString(QuizTypes, card.Type) {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found unknown card type '%s'", card.Type))
+		}
+	}
+
+	return
+}
+
+// Finds timeouts the quiz loop can't use
+type timeoutValidator struct{}
+
+func (v timeoutValidator) Name() string { return "timeout" }
+
+func (v timeoutValidator) Check(quiz Quiz) (issues []Issue) {
+	if quiz.Timeout < 0 || quiz.Timeout > QUIZ_TIMEOUT_MAX {
+		issues = append(issues, newIssue(v, SEVERITY_ERROR, "", "Found timeout out of range 0 (unset) or 1-%d (%d)", QUIZ_TIMEOUT_MAX, quiz.Timeout))
+	}
+
+	return
+}
+
+// Resets the timeout to the default of the game mode
+func (v timeoutValidator) Fix(quiz Quiz) Quiz {
+	quiz.Timeout = 0
+	return quiz
+}
+
+// Finds deck orders arrangeDeck doesn't know, which would silently shuffle
+type orderValidator struct{}
+
+func (v orderValidator) Name() string { return "order" }
+
+func (v orderValidator) Check(quiz Quiz) (issues []Issue) {
+	if !isDeckOrder(quiz.Order) {
+		issues = append(issues, newIssue(v, SEVERITY_ERROR, "", "Found unknown order '%s', expected one of: %s", quiz.Order, strings.Join(DeckOrders, ", ")))
+	}
+
+	return
+}
+
+// Resets the order to the default shuffle
+func (v orderValidator) Fix(quiz Quiz) Quiz {
+	quiz.Order = ""
+	return quiz
+}
+
+// Checks that every local image referenced by the quiz is inside the assets folder, exists and is a decodable image
+// There is no automatic fix for missing files
+type imageAssetValidator struct{}
+
+func (v imageAssetValidator) Name() string { return "image-assets" }
+
+func (v imageAssetValidator) Check(quiz Quiz) (issues []Issue) {
+	for _, card := range quiz.Deck {
+		var paths []string
+		if quiz.CardType(card) == "image" {
+			paths = append(paths, card.Question)
+		}
+		if len(card.Image) > 0 && !isURL(card.Image) {
+			paths = append(paths, card.Image)
+		}
+
+		// Remote images can disappear or change without notice, local assets can't
+		for _, url := range []string{card.Question, card.Image} {
+			if isURL(url) && (url == card.Image || quiz.CardType(card) == "url") {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found remote image %s, move it into %s", url, QUIZ_ASSETS_FOLDER))
+			}
+		}
+
+		for _, path := range paths {
+			err := checkImageAsset(path)
+			if _, ok := err.(*AssetPathError); ok {
+				issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found image path %s outside of %s", path, QUIZ_ASSETS_FOLDER))
+			} else if err != nil {
+				issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found broken image asset: %s", err))
+			}
+		}
+	}
+
+	return
+}
+
+// Finds rendered questions too wide or too tall to be read comfortably
+type longQuestionValidator struct{}
+
+func (v longQuestionValidator) Name() string { return "long-questions" }
+
+func (v longQuestionValidator) Check(quiz Quiz) (issues []Issue) {
+	for _, card := range quiz.Deck {
+		if quiz.CardType(card) != "" {
+			continue
+		}
+
+		lines := strings.Split(card.Question, "\n")
+		if len(lines) > QUESTION_LINES_MAX {
+			issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found question with %d lines, more than %d", len(lines), QUESTION_LINES_MAX))
+		}
+		for _, line := range lines {
+			if width := measureText(line); width > QUESTION_WIDTH_MAX {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found question %dpx wide, more than %dpx", width, QUESTION_WIDTH_MAX))
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// Finds unknown deck fonts and characters of rendered questions that no loaded font has glyphs for
+type glyphValidator struct{}
+
+func (v glyphValidator) Name() string { return "glyphs" }
+
+func (v glyphValidator) Check(quiz Quiz) (issues []Issue) {
+	if fontTtf == nil {
+		return
+	}
+
+	ttf, ok := getFont(quiz.Font)
+	if !ok {
+		issues = append(issues, newIssue(v, SEVERITY_ERROR, "", "Found unknown font %s", quiz.Font))
+	}
+
+	chain := fontChain(ttf)
+	for _, card := range quiz.Deck {
+		if quiz.CardType(card) != "" {
+			continue
+		}
+
+		if missing := missingGlyphs(card.Question+card.Context, chain); len(missing) > 0 {
+			issues = append(issues, newIssue(v, SEVERITY_ERROR, card.Question, "Found characters without glyphs in any font: %s", string(missing)))
+		}
+	}
+
+	return
+}
+
+// Finds kanji in the answers of quizzes asking for readings
+type kanjiAnswerValidator struct{}
+
+func (v kanjiAnswerValidator) Name() string { return "kanji-answers" }
+
+func (v kanjiAnswerValidator) Check(quiz Quiz) (issues []Issue) {
+	if !isReadingQuiz(quiz) {
+		return
+	}
+
+	for _, card := range quiz.Deck {
+		for _, answer := range card.Answers {
+			if hasKanji(answer) {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found kanji in reading answer: %s", answer))
+			}
+		}
+	}
+
+	return
+}
+
+// Returns true if most answers of rendered cards in the quiz are written in kana only
+func isReadingQuiz(quiz Quiz) bool {
+	var total, kana int
+	for _, card := range quiz.Deck {
+		if quiz.CardType(card) != "" {
+			continue
+		}
+		for _, answer := range card.Answers {
+			total++
+			if isKana(answer) {
+				kana++
+			}
+		}
+	}
+
+	return total > 0 && float64(kana) >= float64(total)*READING_QUIZ_RATIO
+}
+
+// Returns true if the string only consists of hiragana and katakana
+func isKana(s string) bool {
+	for _, r := range s {
+		if !unicode.In(r, unicode.Hiragana, unicode.Katakana) && r != 'ー' {
+			return false
+		}
+	}
+
+	return len(s) > 0
+}
+
+// Returns true if the string contains any kanji
+func hasKanji(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a copy of given strings with blank entries removed
+func removeEmpty(strs []string) []string {
+	var result []string
+	for _, s := range strs {
+		if len(strings.TrimSpace(s)) > 0 {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Collects the questions of issues found by a validator
+func issueQuestions(v Validator, quiz Quiz) []string {
+	var questions []string
+	for _, issue := range v.Check(quiz) {
+		questions = append(questions, issue.Question)
+	}
+
+	return questions
+}
+
+func TestEmptyValidation(t *testing.T) {
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "q1", Answers: []string{"a", " "}},
+		{Question: " ", Answers: []string{"b"}},
+		{Question: "q3", Answers: []string{""}},
+		{Question: "q4", Answers: []string{"d"}},
+	}}
+
+	if len(emptyValidator{}.Check(quiz)) != 3 {
+		t.Errorf("Check empty should report 3 issues, got %v", emptyValidator{}.Check(quiz))
+	}
+
+	expected := []Card{
+		{Question: "q1", Answers: []string{"a"}},
+		{Question: "q4", Answers: []string{"d"}},
+	}
+	if fixed := (emptyValidator{}).Fix(quiz); !cmp.Equal(fixed.Deck, expected) {
+		t.Errorf("Fix empty failed: %+v", fixed.Deck)
+	}
+}
+
+func TestKanaDuplicateValidation(t *testing.T) {
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "q1", Answers: []string{"かな", "カナ", "かなー"}},
+		{Question: "q2", Answers: []string{"かな"}},
+	}}
+
+	if questions := issueQuestions(kanaDuplicateValidator{}, quiz); !cmp.Equal(questions, []string{"q1"}) {
+		t.Errorf("Check kana duplicates reported %v", questions)
+	}
+
+	fixed := kanaDuplicateValidator{}.Fix(quiz)
+	if !cmp.Equal(fixed.Deck[0].Answers, []string{"かな", "かなー"}) {
+		t.Errorf("Fix kana duplicates failed: %v", fixed.Deck[0].Answers)
+	}
+}
+
+func TestSettingValidation(t *testing.T) {
+
+	quiz := Quiz{Type: "video", Timeout: -5, Deck: []Card{
+		{Question: "q1", Answers: []string{"a"}, Type: "text"},
+		{Question: "q2", Answers: []string{"b"}, Type: "sound"},
+	}}
+
+	if questions := issueQuestions(typeValidator{}, quiz); !cmp.Equal(questions, []string{"", "q2"}) {
+		t.Errorf("Check types reported %v", questions)
+	}
+
+	if len(timeoutValidator{}.Check(quiz)) != 1 {
+		t.Error("Check timeout should report negative timeout")
+	}
+	if fixed := (timeoutValidator{}).Fix(quiz); fixed.Timeout != 0 {
+		t.Errorf("Fix timeout failed: %d", fixed.Timeout)
+	}
+
+	for _, order := range append([]string{""}, DeckOrders...) {
+		if issues := (orderValidator{}).Check(Quiz{Order: order}); len(issues) != 0 {
+			t.Errorf("Check order reported known order '%s'", order)
+		}
+	}
+	quiz.Order = "random"
+	if len(orderValidator{}.Check(quiz)) != 1 {
+		t.Error("Check order should report unknown order")
+	}
+	if fixed := (orderValidator{}).Fix(quiz); fixed.Order != "" {
+		t.Errorf("Fix order failed: %s", fixed.Order)
+	}
+}
+
+func TestReadingValidation(t *testing.T) {
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "生", Answers: []string{"せい", "いきる", "い", "なま"}},
+		{Question: "生きる", Answers: []string{"生きる"}},
+		{Question: "日", Answers: []string{"にち", "ひ", "び", "か"}},
+		{Question: "日本", Answers: []string{"にほん", "にっぽん"}},
+		{Question: "学生", Answers: []string{"がくせい"}},
+		{Question: "漢字", Answers: []string{"かんじ"}},
+		{Question: "今日", Answers: []string{"きょう"}},
+		{Question: "明日", Answers: []string{"あした"}},
+		{Question: "土", Answers: []string{"ど"}},
+	}}
+
+	if questions := issueQuestions(kanjiAnswerValidator{}, quiz); !cmp.Equal(questions, []string{"生きる"}) {
+		t.Errorf("Check kanji answers reported %v", questions)
+	}
+
+	// Use a small kanji map of our own
+	defer func(saved map[string]Kanji) { KanjiMap = saved }(KanjiMap)
+	KanjiMap = map[string]Kanji{
+		"生": {Character: "生", On: []string{"【小】セイ"}, Kun: []string{"【小】い･きる", "【小】なま"}},
+		"日": {Character: "日", On: []string{"【小】ニチ"}, Kun: []string{"【小】か", "【小】ひ"}},
+	}
+
+	if questions := issueQuestions(readingValidator{}, quiz); !cmp.Equal(questions, []string{"生きる", "日"}) {
+		t.Errorf("Check readings reported %v", questions)
+	}
+}
+
+func TestReadingComposition(t *testing.T) {
+
+	defer func(saved map[string]Kanji) { KanjiMap = saved }(KanjiMap)
+	KanjiMap = map[string]Kanji{
+		"学": {Character: "学", On: []string{"【小】ガク"}, Kun: []string{"【小】まな･ぶ"}},
+		"校": {Character: "校", On: []string{"【小】コウ"}},
+		"生": {Character: "生", On: []string{"【小】セイ", "【小】ショウ"}, Kun: []string{"【小】い･きる", "【△】うぶ"}},
+		"入": {Character: "入", On: []string{"【小】ニュウ"}, Kun: []string{"【小】い･る", "【小】はい･る"}},
+		"口": {Character: "口", On: []string{"【小】コウ"}, Kun: []string{"【小】くち"}},
+		"反": {Character: "反", On: []string{"【小】ハン"}},
+		"応": {Character: "応", On: []string{"【小】オウ"}},
+	}
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "学校", Answers: []string{"がっこう", "がっこお"}},
+		{Question: "入口", Answers: []string{"いりぐち"}},
+		{Question: "反応", Answers: []string{"はんのう"}},
+		{Question: "学ぶ", Answers: []string{"まなぶ"}},
+		{Question: "学生", Answers: []string{"がくせい", "せいと"}},
+	}}
+
+	expected := []string{
+		"Found answer がっこお that looks like a typo of がっこう",
+		"Found answer せいと not composed from known readings",
+	}
+	var messages []string
+	for _, issue := range (readingValidator{}).Check(quiz) {
+		messages = append(messages, issue.Message)
+	}
+	if !cmp.Equal(messages, expected) {
+		t.Errorf("Check reading composition reported %v", messages)
+	}
+
+	// Single kanji lists get checked for missing jouyou readings
+	list := Quiz{Deck: []Card{
+		{Question: "生", Answers: []string{"セイ", "いきる"}},
+		{Question: "学", Answers: []string{"ガク", "まなぶ"}},
+	}}
+	if issues := (readingValidator{}).Check(list); len(issues) != 1 || issues[0].Message != "Found missing jouyou readings: しょう" {
+		t.Errorf("Check missing readings reported %v", issues)
+	}
+}
+
+func TestReadingTypoFalsePositives(t *testing.T) {
+
+	defer func(saved map[string]Kanji) { KanjiMap = saved }(KanjiMap)
+	KanjiMap = map[string]Kanji{
+		"井": {Character: "井", On: []string{"セイ"}, Kun: []string{"い"}},
+		"上": {Character: "上", On: []string{"ジョウ"}, Kun: []string{"うえ"}},
+		"奈": {Character: "奈", On: []string{"ナ"}},
+		"良": {Character: "良", On: []string{"リョウ"}, Kun: []string{"よ･い"}},
+		"県": {Character: "県", On: []string{"ケン"}},
+		"鳥": {Character: "鳥", On: []string{"チョウ"}, Kun: []string{"とり"}},
+		"取": {Character: "取", On: []string{"シュ"}, Kun: []string{"と･る"}},
+		"学": {Character: "学", On: []string{"ガク"}},
+		"校": {Character: "校", On: []string{"コウ"}},
+		"兄": {Character: "兄", On: []string{"キョウ", "ケイ"}, Kun: []string{"あに"}},
+		"大": {Character: "大", On: []string{"ダイ", "タイ"}, Kun: []string{"おお"}},
+		"丈": {Character: "丈", On: []string{"ジョウ"}, Kun: []string{"たけ"}},
+		"夫": {Character: "夫", On: []string{"フ", "フウ"}, Kun: []string{"おっと"}},
+		"住": {Character: "住", On: []string{"ジュウ"}, Kun: []string{"す･む"}},
+		"心": {Character: "心", On: []string{"シン"}, Kun: []string{"こころ"}},
+		"地": {Character: "地", On: []string{"チ", "ジ"}},
+	}
+
+	// Readings with a kana between characters, a character's only kana replaced, a doubled sound,
+	// a voicing change, a shortened vowel or a whole different kana are no typos
+	quiz := Quiz{Deck: []Card{
+		{Question: "井上", Answers: []string{"いのうえ"}},
+		{Question: "奈良県", Answers: []string{"ならけん"}},
+		{Question: "鳥取県", Answers: []string{"とっとりけん"}},
+		{Question: "学校", Answers: []string{"がっこう", "がっこお", "かっこう"}},
+		{Question: "兄さん", Answers: []string{"にいさん"}},
+		{Question: "大丈夫", Answers: []string{"だいじょうぶ", "だいじょぶ"}},
+		{Question: "住み心地", Answers: []string{"すみごこち"}},
+		{Question: "上", Answers: []string{"うえ", "じょう"}},
+		{Question: "県", Answers: []string{"けん"}},
+		{Question: "鳥", Answers: []string{"とり"}},
+		{Question: "大", Answers: []string{"だい"}},
+		{Question: "心", Answers: []string{"しん", "こころ"}},
+		{Question: "地", Answers: []string{"ち", "じ"}},
+	}}
+
+	expected := []string{
+		"notice: Found answer いのうえ not composed from known readings",
+		"notice: Found answer ならけん not composed from known readings",
+		"notice: Found answer とっとりけん not composed from known readings",
+		"warning: Found answer がっこお that looks like a typo of がっこう",
+		"notice: Found answer かっこう not composed from known readings",
+		"notice: Found answer にいさん not composed from known readings",
+		"notice: Found answer だいじょぶ not composed from known readings",
+		"notice: Found answer すみごこち not composed from known readings",
+	}
+	var messages []string
+	for _, issue := range (readingValidator{}).Check(quiz) {
+		messages = append(messages, issue.Severity.String()+": "+issue.Message)
+	}
+	if !cmp.Equal(messages, expected) {
+		t.Errorf("Check reading typos reported %v", messages)
+	}
+
+	// Name decks don't get checked at all
+	loadQuizList()
+	Quizzes.Lock()
+	Quizzes.Map["_readings_names"] = QuizInfo{File: "_readings_names.json", Category: "Name"}
+	Quizzes.Unlock()
+	defer func() {
+		Quizzes.Lock()
+		delete(Quizzes.Map, "_readings_names")
+		Quizzes.Unlock()
+	}()
+	quiz.Name = "_readings_names"
+	if issues := (readingValidator{}).Check(quiz); len(issues) != 0 {
+		t.Errorf("Check readings reported name deck issues %v", issues)
+	}
+}
+
+// Keeps the readings check from flooding the bundled decks with warnings again
+func TestBundledReadingWarnings(t *testing.T) {
+
+	defer func(saved map[string]Kanji) { KanjiMap = saved }(KanjiMap)
+	KanjiMap = nil
+	loadAllKanji()
+	loadQuizList()
+
+	var warnings []string
+	for _, name := range GetQuizlist() {
+		quiz, err := LoadQuiz(name)
+		if err != nil {
+			continue
+		}
+		issues, _ := validateQuiz(quiz)
+		for _, issue := range issues {
+			if issue.Check == "readings" && issue.Severity >= SEVERITY_WARNING {
+				warnings = append(warnings, name+": "+issue.String())
+			}
+		}
+	}
+
+	if len(warnings) > 10 {
+		t.Errorf("Check readings reported %d warnings on bundled decks: %v", len(warnings), warnings)
+	}
+}
+
+func TestLongQuestionValidation(t *testing.T) {
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "短い", Answers: []string{"みじかい"}},
+		{Question: strings.Repeat("長", 40), Answers: []string{"ながい"}},
+		{Question: strings.Repeat("行\n", 12), Answers: []string{"ぎょう"}},
+		{Question: strings.Repeat("text", 40), Answers: []string{"a"}, Type: "text"},
+	}}
+
+	if questions := issueQuestions(longQuestionValidator{}, quiz); len(questions) != 2 {
+		t.Errorf("Check long questions reported %v", questions)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Number of reloads with changes remembered per quiz
+const CHANGE_HISTORY_MAX = 5
+
+// Kinds of card changes between two versions of a deck
+const (
+	CHANGE_ADDED    = "added"
+	CHANGE_REMOVED  = "removed"
+	CHANGE_MODIFIED = "modified"
+)
+
+// CardChange describes how a card with a given question differs between two versions of a deck
+type CardChange struct {
+	Question       string   `json:"question"`
+	Kind           string   `json:"kind"`
+	Answers        []string `json:"answers,omitempty"` // Answers of added and removed cards
+	AddedAnswers   []string `json:"added_answers,omitempty"`
+	RemovedAnswers []string `json:"removed_answers,omitempty"`
+	Fields         []string `json:"fields,omitempty"` // Other changed card fields, like comment or tags
+}
+
+func (c CardChange) String() string {
+	switch c.Kind {
+	case CHANGE_ADDED:
+		return fmt.Sprintf("+ %s: %s", c.Question, strings.Join(c.Answers, ", "))
+	case CHANGE_REMOVED:
+		return fmt.Sprintf("- %s: %s", c.Question, strings.Join(c.Answers, ", "))
+	}
+
+	var parts []string
+	for _, answer := range c.AddedAnswers {
+		parts = append(parts, "+"+answer)
+	}
+	for _, answer := range c.RemovedAnswers {
+		parts = append(parts, "-"+answer)
+	}
+	if len(c.Fields) > 0 {
+		parts = append(parts, "changed "+strings.Join(c.Fields, ", "))
+	}
+
+	return fmt.Sprintf("~ %s: %s", c.Question, strings.Join(parts, " "))
+}
+
+// DeckChanges keeps the card changes found when quiz files got reloaded, newest last
+var DeckChanges struct {
+	sync.RWMutex
+	Map map[string][]ChangeRecord
+}
+
+// Card changes found in one reload of a quiz file
+type ChangeRecord struct {
+	Time    time.Time
+	Since   time.Time // Modification time of the file version the changes were made to
+	Changes []CardChange
+}
+
+// Compare two versions of a deck by card question
+// Added and modified cards come in new deck order, followed by removed cards in old deck order
+func diffDecks(old Quiz, new Quiz) []CardChange {
+
+	oldCards := make(map[string]Card, len(old.Deck))
+	for _, card := range old.Deck {
+		if _, ok := oldCards[card.Question]; !ok {
+			oldCards[card.Question] = card
+		}
+	}
+	newCards := make(map[string]bool, len(new.Deck))
+
+	var changes []CardChange
+	for _, card := range new.Deck {
+		if newCards[card.Question] {
+			continue
+		}
+		newCards[card.Question] = true
+
+		oldCard, ok := oldCards[card.Question]
+		if !ok {
+			changes = append(changes, CardChange{Question: card.Question, Kind: CHANGE_ADDED, Answers: card.Answers})
+			continue
+		}
+
+		change := CardChange{
+			Question:       card.Question,
+			Kind:           CHANGE_MODIFIED,
+			AddedAnswers:   missingStrings(card.Answers, oldCard.Answers),
+			RemovedAnswers: missingStrings(oldCard.Answers, card.Answers),
+			Fields:         changedFields(oldCard, card),
+		}
+		if len(change.AddedAnswers) > 0 || len(change.RemovedAnswers) > 0 || len(change.Fields) > 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	for _, card := range old.Deck {
+		if !newCards[card.Question] {
+			newCards[card.Question] = true
+			changes = append(changes, CardChange{Question: card.Question, Kind: CHANGE_REMOVED, Answers: card.Answers})
+		}
+	}
+
+	return changes
+}
+
+// Returns the strings of a that are not in b
+func missingStrings(a []string, b []string) []string {
+	var missing []string
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, s)
+		}
+	}
+
+	return missing
+}
+
+// Returns the sorted names of card fields other than question and answers that differ
+func changedFields(old Card, new Card) []string {
+
+	oldFields, err := jsonFields(old)
+	if err != nil {
+		return nil
+	}
+	newFields, err := jsonFields(new)
+	if err != nil {
+		return nil
+	}
+
+	var fields []string
+	for name, value := range newFields {
+		if name != "question" && name != "answers" && !bytes.Equal(value, oldFields[name]) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// Remember the changes of a reloaded quiz file made to the version modified at since, dropping the oldest records
+// Changes to a version already recorded are only kept once
+func recordChanges(name string, since time.Time, changes []CardChange) {
+	DeckChanges.Lock()
+	defer DeckChanges.Unlock()
+	if DeckChanges.Map == nil {
+		DeckChanges.Map = make(map[string][]ChangeRecord)
+	}
+	for _, record := range DeckChanges.Map[name] {
+		if record.Since.Equal(since) {
+			return
+		}
+	}
+	records := append(DeckChanges.Map[name], ChangeRecord{time.Now(), since, changes})
+	if len(records) > CHANGE_HISTORY_MAX {
+		records = records[len(records)-CHANGE_HISTORY_MAX:]
+	}
+	DeckChanges.Map[name] = records
+}
+
+// Show the changes recorded for a quiz since bot startup in channel
+func sendChanges(s *discordgo.Session, cid string, name string) {
+
+	DeckChanges.RLock()
+	records := DeckChanges.Map[name]
+	DeckChanges.RUnlock()
+
+	if len(records) == 0 {
+		msgSend(s, cid, fmt.Sprintf("No changes to '%s' recorded since %s.", name, Settings.TimeStarted.Format("2006-01-02 15:04")))
+		return
+	}
+
+	// Newest changes first
+	var fields []*discordgo.MessageEmbedField
+	for i := len(records) - 1; i >= 0; i-- {
+		var lines []string
+		for _, change := range records[i].Changes {
+			lines = append(lines, change.String())
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("%s (%d cards)", records[i].Time.Format("2006-01-02 15:04"), len(records[i].Changes)),
+			Value:  fmt.Sprintf("```%s```", truncate(strings.Join(lines, "\n"), DISCORD_FIELD_MAX-6)),
+			Inline: false,
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Type:   "rich",
+		Title:  fmt.Sprintf(":pencil: Recent changes to %s", name),
+		Color:  0xFADE40,
+		Fields: fields,
+	}
+
+	embedSend(s, cid, embed)
+}
+
+// Compare two deck files offline, printing the changes as text or JSON
+func diffCommand(args []string) int {
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	jsonReport := fs.Bool("json", false, "print the changes as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff [options] <old.json|tsv|yaml> <new.json|tsv|yaml>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var quizzes [2]Quiz
+	for i, filename := range fs.Args() {
+		file, err := os.Open(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Reading quiz:", err)
+			return 1
+		}
+		quizzes[i], err = decodeQuiz(filename, file)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR, Decoding quiz %s: %s\n", filename, err)
+			return 1
+		}
+	}
+
+	changes := diffDecks(quizzes[0], quizzes[1])
+
+	if *jsonReport {
+		if changes == nil {
+			changes = []CardChange{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(changes); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Encoding changes:", err)
+			return 1
+		}
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, change := range changes {
+		fmt.Println(change)
+		counts[change.Kind]++
+	}
+	fmt.Printf("%d added, %d removed, %d modified\n", counts[CHANGE_ADDED], counts[CHANGE_REMOVED], counts[CHANGE_MODIFIED])
+
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffDecks(t *testing.T) {
+
+	old := Quiz{Deck: []Card{
+		{Question: "q1", Answers: []string{"a", "b"}},
+		{Question: "q2", Answers: []string{"c"}, Comment: "old"},
+		{Question: "q3", Answers: []string{"d"}},
+		{Question: "q4", Answers: []string{"e"}},
+	}}
+	new := Quiz{Deck: []Card{
+		{Question: "q5", Answers: []string{"f"}},
+		{Question: "q1", Answers: []string{"a", "x"}},
+		{Question: "q2", Answers: []string{"c"}, Comment: "new", Tags: []string{"noun"}},
+		{Question: "q4", Answers: []string{"e"}},
+	}}
+
+	expected := []CardChange{
+		{Question: "q5", Kind: CHANGE_ADDED, Answers: []string{"f"}},
+		{Question: "q1", Kind: CHANGE_MODIFIED, AddedAnswers: []string{"x"}, RemovedAnswers: []string{"b"}},
+		{Question: "q2", Kind: CHANGE_MODIFIED, Fields: []string{"comment", "tags"}},
+		{Question: "q3", Kind: CHANGE_REMOVED, Answers: []string{"d"}},
+	}
+
+	changes := diffDecks(old, new)
+	if !cmp.Equal(changes, expected) {
+		t.Errorf("Deck diff mismatch: %s", cmp.Diff(expected, changes))
+	}
+
+	if s := changes[1].String(); s != "~ q1: +x -b" {
+		t.Errorf("Unexpected change text: %s", s)
+	}
+
+	if changes := diffDecks(old, old); len(changes) > 0 {
+		t.Errorf("Identical decks should have no changes: %v", changes)
+	}
+}
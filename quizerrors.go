@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum number of "did you mean" suggestions for unknown quiz names
+const QUIZ_SUGGESTIONS_MAX = 3
+
+// UnknownQuizError is returned for quiz names missing from the Quiz List
+type UnknownQuizError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownQuizError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("Unknown quiz '%s'", e.Name)
+	}
+	return fmt.Sprintf("Unknown quiz '%s', did you mean: %s?", e.Name, strings.Join(e.Suggestions, ", "))
+}
+
+// MissingFileError is returned when a listed quiz has no file on disk
+type MissingFileError struct {
+	Name string
+	File string
+}
+
+func (e *MissingFileError) Error() string {
+	return fmt.Sprintf("Quiz file '%s' for '%s' is missing", e.File, e.Name)
+}
+
+// ParseError is returned for quiz files that fail to decode, with the position if known
+// Lines and columns count from 1, zero meaning unknown
+type ParseError struct {
+	Name   string
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	// YAML and TSV errors already mention the line themselves
+	if e.Column > 0 {
+		return fmt.Sprintf("Quiz file '%s' for '%s' is broken at line %d, column %d: %s", e.File, e.Name, e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("Quiz file '%s' for '%s' is broken: %s", e.File, e.Name, e.Err)
+}
+
+// EmptyQuizError is returned for quizzes that end up without any cards
+type EmptyQuizError struct {
+	Name string
+}
+
+func (e *EmptyQuizError) Error() string {
+	return fmt.Sprintf("Quiz '%s' has no cards", e.Name)
+}
+
+// IncludeError is returned for include cycles and includes that fail to filter,
+// with the chain of quizzes from the one loaded down to the failing include
+type IncludeError struct {
+	Chain []string
+	Err   error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("Include chain %s: %s", strings.Join(e.Chain, " -> "), e.Err)
+}
+
+// Line numbers as reported by YAML and TSV decoding errors
+var errorLineRegexp = regexp.MustCompile(`\bline (\d+)\b`)
+
+// Wrap a decoding error into a ParseError, locating it in the file data where possible
+func newParseError(name string, filename string, data []byte, err error) *ParseError {
+
+	pe := &ParseError{Name: name, File: filename, Err: err}
+
+	var offset int64 = -1
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		if match := errorLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+			pe.Line, _ = strconv.Atoi(match[1])
+		}
+	}
+
+	// JSON offsets point right after the offending byte, which can be a newline ending its line
+	if offset > 0 && offset <= int64(len(data)) {
+		before := data[:offset-1]
+		pe.Line = bytes.Count(before, []byte("\n")) + 1
+		pe.Column = utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	}
+
+	return pe
+}
+
+// Returns quiz names similar to the given one, closest first
+func suggestQuizzes(name string) []string {
+
+	type candidate struct {
+		Name     string
+		Distance int
+	}
+
+	var candidates []candidate
+	for _, quiz := range GetQuizlist() {
+		distance := editDistance(name, quiz)
+
+		// Allow roughly one typo per three characters, and count prefixes as close
+		if distance <= maxint(1, utf8.RuneCountInString(name)/3) || (len(name) >= 2 && strings.HasPrefix(quiz, name)) {
+			candidates = append(candidates, candidate{quiz, distance})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Distance == candidates[j].Distance {
+			return candidates[i].Name < candidates[j].Name
+		}
+		return candidates[i].Distance < candidates[j].Distance
+	})
+
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < QUIZ_SUGGESTIONS_MAX; i++ {
+		suggestions = append(suggestions, candidates[i].Name)
+	}
+
+	return suggestions
+}
+
+// Levenshtein distance between two strings, counted in runes
+func editDistance(a string, b string) int {
+
+	ra, rb := []rune(a), []rune(b)
+
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			prev, row[j] = row[j], minint(minint(row[j]+1, row[j-1]+1), prev+cost)
+		}
+	}
+
+	return row[len(rb)]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadErrors(t *testing.T) {
+
+	files := map[string]string{
+		"_errors_broken": "{\n\t\"description\": \"Broken\",\n\t\"deck\": [ { \"question\": \"q1\" \"answers\": [ \"a\" ] } ]\n}",
+		"_errors_empty":  `{ "description": "Empty", "deck": [] }`,
+	}
+
+	loadQuizList()
+	for name, data := range files {
+		if err := ioutil.WriteFile(QUIZ_FOLDER+name+".json", []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(QUIZ_FOLDER + name + ".json")
+	}
+
+	Quizzes.Lock()
+	Quizzes.Map["_errors_broken"] = QuizInfo{File: "_errors_broken.json"}
+	Quizzes.Map["_errors_empty"] = QuizInfo{File: "_errors_empty.json"}
+	Quizzes.Map["_errors_missing"] = QuizInfo{File: "_errors_missing.json"}
+	Quizzes.Unlock()
+
+	_, err := LoadQuiz("_errors_brokne")
+	if e, ok := err.(*UnknownQuizError); !ok || !cmp.Equal(e.Suggestions, []string{"_errors_broken"}) {
+		t.Errorf("Expected unknown quiz with suggestion, got %#v", err)
+	}
+
+	if _, err := LoadQuiz("_errors_missing"); err == nil {
+		t.Error("Expected missing file error")
+	} else if _, ok := err.(*MissingFileError); !ok {
+		t.Errorf("Expected missing file error, got %#v", err)
+	}
+
+	_, err = LoadQuiz("_errors_broken")
+	if e, ok := err.(*ParseError); !ok || e.Line != 3 || e.Column != 31 {
+		t.Errorf("Expected parse error at line 3, column 31, got %#v", err)
+	}
+
+	// Offending newlines are located at the end of their line
+	data := []byte("{\n\t\"description\": \"Broken\n\"\n}")
+	var quiz Quiz
+	pe := newParseError("_errors_newline", "_errors_newline.json", data, json.Unmarshal(data, &quiz))
+	if pe.Line != 2 || pe.Column != 24 || !strings.Contains(pe.Error(), "line 2, column 24") {
+		t.Errorf("Expected parse error at line 2, column 24, got %#v", pe)
+	}
+
+	if _, err := LoadQuiz("_errors_empty"); err == nil {
+		t.Error("Expected empty quiz error")
+	} else if _, ok := err.(*EmptyQuizError); !ok {
+		t.Errorf("Expected empty quiz error, got %#v", err)
+	}
+}
+
+func TestQuizListSchema(t *testing.T) {
+
+	// Both entry forms and all metadata fields
+	fixture := `{
+	"plain": "plain.json",
+	"full":  { "file": "full.json", "category": "Educational", "author": "someone", "difficulty": "hard", "language": "en-ja", "nsfw": true, "hidden": true }
+}`
+	expected := map[string]QuizInfo{
+		"plain": {File: "plain.json"},
+		"full":  {File: "full.json", Category: "Educational", Author: "someone", Difficulty: "hard", Language: "en-ja", NSFW: true, Hidden: true},
+	}
+
+	var list map[string]QuizInfo
+	if err := json.Unmarshal([]byte(fixture), &list); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(list, expected) {
+		t.Errorf("Quiz List fixture parsed as %+v", list)
+	}
+	if labels := list["full"].Labels(); !cmp.Equal(labels, []string{"en-ja", "by someone", "nsfw"}) {
+		t.Errorf("Quiz List labels are %v", labels)
+	}
+	if labels := list["plain"].Labels(); len(labels) != 0 {
+		t.Errorf("Plain Quiz List entry has labels %v", labels)
+	}
+
+	// The bundled list has to stick to the same fields and values
+	if err := loadQuizList(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range GetQuizlist() {
+		info, _ := GetQuizInfo(name)
+		if len(info.File) == 0 || (len(info.Category) > 0 && !hasString(QuizCategories, info.Category)) ||
+			(len(info.Difficulty) > 0 && !hasString([]string{"easy", "normal", "hard"}, info.Difficulty)) ||
+			(len(info.Language) > 0 && len(strings.Split(info.Language, "-")) != 2) {
+			t.Errorf("Quiz List entry '%s' has bad metadata: %+v", name, info)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+
+	cases := []struct {
+		A, B     string
+		Expected int
+	}{
+		{"", "abc", 3},
+		{"kanken", "kanken", 0},
+		{"kanekn", "kanken", 2},
+		{"n1", "n2", 1},
+		{"漢字", "漢検", 1},
+	}
+
+	for _, c := range cases {
+		if d := editDistance(c.A, c.B); d != c.Expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", c.A, c.B, d, c.Expected)
+		}
+	}
+}
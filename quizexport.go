@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Supported export formats
+var ExportFormats = []string{"apkg", "csv", "tsv"}
+
+// Anki collection schema, version 11
+const ankiSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld text not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// Anki note type with Question, Answers and Comment fields
+const ankiModel = `{"%[1]d": {
+	"id": %[1]d, "name": "Kanji Quiz Bot", "type": 0, "mod": %[3]d, "usn": -1, "sortf": 0, "did": %[2]d,
+	"tmpls": [{"name": "Card 1", "ord": 0, "qfmt": "<div class=question>{{Question}}</div>", "afmt": "{{FrontSide}}<hr id=answer>{{Answers}}<br><br><span class=comment>{{Comment}}</span>", "did": null, "bqfmt": "", "bafmt": ""}],
+	"flds": [
+		{"name": "Question", "ord": 0, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []},
+		{"name": "Answers", "ord": 1, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []},
+		{"name": "Comment", "ord": 2, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []}
+	],
+	"css": ".card { font-family: sans-serif; font-size: 24px; text-align: center; } .question { font-size: 48px; } .comment { font-size: 16px; white-space: pre-wrap; }",
+	"latexPre": "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+	"latexPost": "\\end{document}",
+	"tags": [], "vers": [], "req": [[0, "all", [0]]]
+}}`
+
+// Anki deck list with the default deck and the exported one
+const ankiDecks = `{
+	"1": {"id": 1, "name": "Default", "desc": "", "mod": %[3]d, "usn": -1, "collapsed": false, "newToday": [0, 0], "revToday": [0, 0], "lrnToday": [0, 0], "timeToday": [0, 0], "dyn": 0, "conf": 1, "extendNew": 10, "extendRev": 50},
+	"%[1]d": {"id": %[1]d, "name": %[2]s, "desc": %[4]s, "mod": %[3]d, "usn": -1, "collapsed": false, "newToday": [0, 0], "revToday": [0, 0], "lrnToday": [0, 0], "timeToday": [0, 0], "dyn": 0, "conf": 1, "extendNew": 10, "extendRev": 50}
+}`
+
+// Anki default deck options and collection settings
+const ankiDeckConf = `{"1": {"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+	"new": {"bury": true, "delays": [1, 10], "initialFactor": 2500, "ints": [1, 4, 7], "order": 1, "perDay": 20, "separate": true},
+	"lapse": {"delays": [10], "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0},
+	"rev": {"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "perDay": 100}
+}}`
+
+const ankiConf = `{"nextPos": 1, "estTimes": true, "activeDecks": [1], "sortType": "noteFld", "timeLim": 0, "sortBackwards": false, "addToCur": true, "curDeck": 1, "newBury": true, "newSpread": 0, "dueCounts": true, "curModel": null, "collapseTime": 1200}`
+
+// Export a quiz in given format, returning the file contents and filename
+func exportQuiz(name string, quiz Quiz, format string) ([]byte, string, error) {
+
+	switch format {
+	case "csv":
+		b, err := exportDelimited(quiz, ',')
+		return b, name + ".csv", err
+	case "tsv":
+		b, err := exportDelimited(quiz, '\t')
+		return b, name + ".tsv", err
+	case "apkg", "anki":
+		b, err := exportAnki(name, quiz)
+		return b, name + ".apkg", err
+	}
+
+	return nil, "", fmt.Errorf("Unknown export format '%s', use one of: %s", format, strings.Join(ExportFormats, ", "))
+}
+
+// Export quiz cards as question, answers and comment columns
+func exportDelimited(quiz Quiz, separator rune) ([]byte, error) {
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = separator
+
+	for _, card := range quiz.Deck {
+		if err := w.Write([]string{card.Question, strings.Join(card.Answers, ", "), card.Comment}); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// Export quiz cards as an Anki package, which is a zipped SQLite collection
+func exportAnki(name string, quiz Quiz) ([]byte, error) {
+
+	// SQLite needs a real file to work with
+	tmp, err := ioutil.TempFile("", "kanjiquizbot-anki-")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	db, err := sql.Open("sqlite3", tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(ankiSchema); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	modelID := now.UnixNano() / int64(time.Millisecond)
+	deckID := modelID + 1
+
+	deckName, err := json.Marshal("Kanji Quiz Bot::" + name)
+	if err != nil {
+		return nil, err
+	}
+	deckDesc, err := json.Marshal(quiz.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		now.Unix(), modelID, modelID,
+		ankiConf,
+		fmt.Sprintf(ankiModel, modelID, deckID, now.Unix()),
+		fmt.Sprintf(ankiDecks, deckID, deckName, now.Unix(), deckDesc),
+		ankiDeckConf,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, card := range quiz.Deck {
+		id := modelID + int64(i) + 2
+		fields := []string{
+			ankiEscape(card.Question),
+			ankiEscape(strings.Join(card.Answers, ", ")),
+			ankiEscape(card.Comment),
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')",
+			id, ankiGUID(), modelID, now.Unix(), ankiTags(card.Tags), strings.Join(fields, "\x1f"), card.Question, ankiChecksum(card.Question),
+		)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO cards VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')",
+			id, id, deckID, now.Unix(), i+1,
+		)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	db.Close()
+
+	collection, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// Package the collection with an empty media list
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		Name string
+		Data []byte
+	}{
+		{"collection.anki2", collection},
+		{"media", []byte("{}")},
+	} {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Escape plain text for Anki's HTML fields
+func ankiEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\n", "<br>").Replace(s)
+}
+
+// Anki tags are space separated with surrounding spaces
+func ankiTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	cleaned := make([]string, len(tags))
+	for i, tag := range tags {
+		cleaned[i] = strings.Replace(strings.TrimSpace(tag), " ", "_", -1)
+	}
+
+	return " " + strings.Join(cleaned, " ") + " "
+}
+
+// Random globally unique note identifier
+func ankiGUID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Anki's duplicate check sum, the first 32 bits of the sort field's SHA1
+func ankiChecksum(s string) int64 {
+	sum := sha1.Sum([]byte(s))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// Send an exported deck or review list to the user by Direct Message
+func sendExport(s *discordgo.Session, m *discordgo.MessageCreate, quizname string, format string) error {
+
+	var quiz Quiz
+	if quizname == "review" {
+		quiz = peekReview(m.ChannelID)
+	} else {
+		var err error
+		if quiz, err = LoadQuiz(quizname); err != nil {
+			return err
+		}
+	}
+	if len(quiz.Deck) == 0 {
+		return fmt.Errorf("Nothing to export for '%s'", quizname)
+	}
+
+	data, filename, err := exportQuiz(quizname, quiz, format)
+	if err != nil {
+		return err
+	}
+
+	ch, err := s.UserChannelCreate(m.Author.ID)
+	if err != nil {
+		return fmt.Errorf("Could not open Direct Message channel")
+	}
+
+	// Try thrice in case of timeouts
+	retryErr := retryOnServerError(func() error {
+		_, err := s.ChannelFileSend(ch.ID, filename, bytes.NewReader(data))
+		return err
+	})
+	if retryErr != nil {
+		return fmt.Errorf("Could not send exported file")
+	}
+
+	return nil
+}
+
+// Export whole decks from the quizzes folder to files
+func exportCommand(args []string) int {
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "apkg", "export format: "+strings.Join(ExportFormats, ", "))
+	outDir := fs.String("o", ".", "output folder")
+	all := fs.Bool("all", false, "export every deck in the quiz list")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [options] <deck>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := loadQuizList(); err != nil {
+		return 1
+	}
+
+	names := fs.Args()
+	if *all {
+		names = GetQuizlist()
+	}
+	if len(names) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, name := range names {
+		quiz, err := LoadQuiz(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR,", err)
+			status = 1
+			continue
+		}
+
+		data, filename, err := exportQuiz(name, quiz, *format)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(*outDir, filename), data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR, Exporting quiz '%s': %s\n", name, err)
+			status = 1
+			continue
+		}
+
+		fmt.Printf("Exported %d cards from '%s' to %s\n", len(quiz.Deck), name, filename)
+	}
+
+	return status
+}
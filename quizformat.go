@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Separator between answers in the TSV deck format
+const TSV_ANSWER_SEP = '|'
+
+// Card fields that have their own TSV columns
+var tsvCardColumns = []string{"question", "answers", "comment"}
+
+// Decode quiz data in the format given by the filename extension
+func decodeQuiz(filename string, r io.Reader) (quiz Quiz, err error) {
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv":
+		quiz, err = decodeQuizTSV(r)
+	case ".yaml", ".yml":
+		var data []byte
+		if data, err = ioutil.ReadAll(r); err == nil {
+			err = yaml.UnmarshalStrict(data, &quiz)
+		}
+
+		// Cards without answers come out as they do from JSON and TSV
+		for i := range quiz.Deck {
+			if len(quiz.Deck[i].Answers) == 0 {
+				quiz.Deck[i].Answers = nil
+			}
+		}
+	default:
+		err = json.NewDecoder(r).Decode(&quiz)
+	}
+
+	return
+}
+
+// Encode quiz data in the format given by the filename extension
+func encodeQuiz(filename string, buf *bytes.Buffer, quiz Quiz) error {
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".tsv":
+		return encodeQuizTSV(buf, quiz)
+	case ".yaml", ".yml":
+		data, err := yaml.Marshal(&quiz)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+
+	return encodeQuizJSON(buf, quiz)
+}
+
+// Write quiz to disk in the format given by the filename extension
+func writeQuiz(filename string, quiz Quiz) error {
+
+	var buf bytes.Buffer
+	if err := encodeQuiz(filename, &buf, quiz); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// Encode quiz as JSON in the README layout, with one card per line
+func encodeQuizJSON(buf *bytes.Buffer, quiz Quiz) error {
+
+	// Lay out deck level settings with regular indentation
+	head := quiz
+	head.Deck = []Card{}
+	b, err := marshalJSON(head)
+	if err != nil {
+		return err
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, b, "", "\t"); err != nil {
+		return err
+	}
+
+	// Deck is the last field, so cut off its empty array and fill in the cards
+	buf.WriteString(strings.TrimSuffix(indented.String(), "[]\n}"))
+	buf.WriteString("[\n")
+	for i, card := range quiz.Deck {
+		b, err := marshalJSON(card)
+		if err != nil {
+			return err
+		}
+
+		buf.WriteString("\t\t")
+		buf.Write(spaceJSON(b))
+		if i < len(quiz.Deck)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\t]\n}\n")
+
+	return nil
+}
+
+// Marshal JSON without escaping HTML characters
+func marshalJSON(v interface{}) ([]byte, error) {
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Add spacing to compact JSON in the style of the deck files
+func spaceJSON(b []byte) []byte {
+
+	result := make([]byte, 0, len(b)+len(b)/4)
+	inString, escaped := false, false
+	for i, c := range b {
+		result = append(result, c)
+
+		// Leave string contents alone
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			if inString {
+				continue
+			}
+		} else if c == '"' {
+			inString = true
+			continue
+		}
+
+		var next byte
+		if i+1 < len(b) {
+			next = b[i+1]
+		}
+
+		// Pad after openers and separators, and before closers, except for empty brackets
+		switch {
+		case c == '{' || c == '[':
+			if next != '}' && next != ']' {
+				result = append(result, ' ')
+			}
+		case c == ',' || c == ':':
+			result = append(result, ' ')
+		case next == '}' || next == ']':
+			result = append(result, ' ')
+		}
+	}
+
+	return result
+}
+
+// Encode quiz as TSV, with deck settings as "# key: value" header lines,
+// then one card per line as question, answers, comment and other card fields as JSON
+func encodeQuizTSV(buf *bytes.Buffer, quiz Quiz) error {
+
+	// Write out deck level settings, description first
+	head := quiz
+	head.Deck = nil
+	settings, err := jsonFields(head)
+	if err != nil {
+		return err
+	}
+	delete(settings, "deck")
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		if key != "description" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"description"}, keys...)
+
+	for _, key := range keys {
+		fmt.Fprintf(buf, "# %s: %s\n", key, settings[key])
+	}
+
+	for _, card := range quiz.Deck {
+		answers := make([]string, len(card.Answers))
+		for i, answer := range card.Answers {
+			answers[i] = escapeTSV(answer, TSV_ANSWER_SEP)
+		}
+
+		question := escapeTSV(card.Question, 0)
+		if strings.HasPrefix(question, "#") {
+			question = "\\" + question
+		}
+
+		columns := []string{
+			question,
+			strings.Join(answers, string(TSV_ANSWER_SEP)),
+			escapeTSV(card.Comment, 0),
+		}
+
+		// Everything else goes into a trailing JSON column
+		extra, err := jsonFields(card)
+		if err != nil {
+			return err
+		}
+		for _, key := range tsvCardColumns {
+			delete(extra, key)
+		}
+		if len(extra) > 0 {
+			b, err := marshalJSON(extra)
+			if err != nil {
+				return err
+			}
+			columns = append(columns, escapeTSV(string(b), 0))
+		} else if len(card.Comment) == 0 {
+			columns = columns[:2]
+		}
+
+		buf.WriteString(strings.Join(columns, "\t"))
+		buf.WriteString("\n")
+	}
+
+	return nil
+}
+
+// Decode quiz from the TSV format written by encodeQuizTSV
+func decodeQuizTSV(r io.Reader) (quiz Quiz, err error) {
+
+	var settings []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+
+		// Collect deck settings into a JSON object
+		if strings.HasPrefix(text, "#") {
+			parts := strings.SplitN(strings.TrimPrefix(text, "#"), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			key, err := json.Marshal(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return quiz, err
+			}
+			settings = append(settings, string(key)+":"+strings.TrimSpace(parts[1]))
+			continue
+		}
+
+		columns := strings.Split(text, "\t")
+		if len(columns) < 2 {
+			return quiz, fmt.Errorf("line %d: expected question and answers separated by a tab", line)
+		}
+
+		var card Card
+		if len(columns) >= 4 {
+			if err := json.Unmarshal([]byte(unescapeTSV(columns[3], 0)[0]), &card); err != nil {
+				return quiz, fmt.Errorf("line %d: %s", line, err)
+			}
+		}
+
+		card.Question = unescapeTSV(columns[0], 0)[0]
+		if len(columns[1]) > 0 {
+			card.Answers = unescapeTSV(columns[1], TSV_ANSWER_SEP)
+		}
+		if len(columns) >= 3 {
+			card.Comment = unescapeTSV(columns[2], 0)[0]
+		}
+
+		quiz.Deck = append(quiz.Deck, card)
+	}
+	if err := scanner.Err(); err != nil {
+		return quiz, err
+	}
+
+	if len(settings) > 0 {
+		deck := quiz.Deck
+		if err := json.Unmarshal([]byte("{"+strings.Join(settings, ",")+"}"), &quiz); err != nil {
+			return quiz, fmt.Errorf("deck settings: %s", err)
+		}
+		quiz.Deck = deck
+	}
+
+	return quiz, nil
+}
+
+// Escape backslashes, tabs, newlines and the given separator for TSV
+func escapeTSV(s string, sep rune) string {
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case sep != 0 && r == sep:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// Unescape a TSV field, splitting on unescaped separators if given
+func unescapeTSV(s string, sep rune) []string {
+
+	var parts []string
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			switch r {
+			case 't':
+				b.WriteRune('\t')
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			default:
+				b.WriteRune(r)
+			}
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else if sep != 0 && r == sep {
+			parts = append(parts, b.String())
+			b.Reset()
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return append(parts, b.String())
+}
+
+// Marshal a value into a map of its JSON fields
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+
+	b, err := marshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+
+	return fields, err
+}
+
+// Convert decks between JSON, TSV and YAML formats
+func convertCommand(args []string) int {
+
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s convert <input.json|tsv|yaml> <output.json|tsv|yaml>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Reading quiz:", err)
+		return 1
+	}
+	quiz, err := decodeQuiz(fs.Arg(0), file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Decoding quiz:", err)
+		return 1
+	}
+
+	if err := writeQuiz(fs.Arg(1), quiz); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Writing quiz:", err)
+		return 1
+	}
+
+	fmt.Printf("Converted %d cards from %s to %s\n", len(quiz.Deck), fs.Arg(0), fs.Arg(1))
+
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+
+	quiz := Quiz{
+		Description: "Round trip: \"quotes\", tabs\tand | pipes",
+		Type:        "text",
+		Timeout:     30,
+		Order:       "sequential",
+		Deck: []Card{
+			{Question: "未来", Answers: []string{"みらい"}},
+			{Question: "#hash\tstart", Answers: []string{"a|b", `back\slash`}, Comment: "line 1\nline 2"},
+			{Question: "q3", Answers: []string{"c"}, Difficulty: 3, Weight: 1.5, Tags: []string{"noun", "n5"}, Source: "Textbook", Furigana: "未来（みらい）"},
+			{Question: "q4", Comment: "no answers yet"},
+		},
+	}
+
+	for _, filename := range []string{"deck.json", "deck.tsv", "deck.yaml"} {
+		var buf bytes.Buffer
+		if err := encodeQuiz(filename, &buf, quiz); err != nil {
+			t.Fatalf("Encoding %s failed: %s", filename, err)
+		}
+
+		decoded, err := decodeQuiz(filename, &buf)
+		if err != nil {
+			t.Fatalf("Decoding %s failed: %s", filename, err)
+		}
+
+		if !cmp.Equal(quiz, decoded) {
+			t.Errorf("Round trip through %s failed: %s", filename, cmp.Diff(quiz, decoded))
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Anki note with its note type field names
+type ankiNote struct {
+	Names  []string
+	Fields []string
+}
+
+// Mapping from Anki note fields to card parts, by field name or index
+type ankiFieldMap struct {
+	Question string
+	Answers  string
+	Comment  string
+}
+
+// Patterns for stripping Anki HTML markup
+var (
+	ankiBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>`)
+	ankiTagRegexp   = regexp.MustCompile(`<[^>]*>`)
+	ankiSoundRegexp = regexp.MustCompile(`\[sound:[^\]]*\]`)
+)
+
+// Import an Anki package or text export as a quiz deck
+func importCommand(args []string) int {
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	name := fs.String("name", "", "quiz name to register (defaults to input filename)")
+	description := fs.String("description", "", "quiz description")
+	quizType := fs.String("type", "", "quiz type (text, url, image or empty for rendered images)")
+	question := fs.String("question", "0", "note field name or index for the question")
+	answers := fs.String("answers", "1", "note field name or index for the answers")
+	comment := fs.String("comment", "", "note field name or index for the comment")
+	separators := fs.String("sep", ",、;；", "characters separating multiple answers in a field")
+	register := fs.Bool("register", true, "register the quiz in the quiz list")
+	force := fs.Bool("force", false, "replace an existing quiz file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s import [options] <file.apkg|file.txt>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	input := fs.Arg(0)
+
+	if len(*name) == 0 {
+		*name = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	}
+	if len(*description) == 0 {
+		*description = "Imported from " + filepath.Base(input)
+	}
+
+	// Read the notes from either format
+	var notes []ankiNote
+	var err error
+	if strings.EqualFold(filepath.Ext(input), ".apkg") {
+		notes, err = readAnkiPackage(input)
+	} else {
+		notes, err = readAnkiText(input)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Reading Anki notes:", err)
+		return 1
+	}
+
+	quiz := Quiz{
+		Description: *description,
+		Type:        *quizType,
+	}
+
+	fields := ankiFieldMap{*question, *answers, *comment}
+	for _, note := range notes {
+		card, ok := fields.Card(note, *separators)
+		if ok {
+			quiz.Deck = append(quiz.Deck, card)
+		}
+	}
+
+	if len(quiz.Deck) == 0 {
+		fmt.Fprintln(os.Stderr, "ERROR, No cards found with given field mapping")
+		return 1
+	}
+
+	// Refuse to overwrite decks by accident
+	filename := *name + ".json"
+	if _, err := os.Stat(QUIZ_FOLDER + filename); err == nil {
+		decks := "no registered deck"
+		if names := quizzesWithFile(filename); len(names) > 0 {
+			decks = "deck '" + strings.Join(names, "', '") + "'"
+		}
+		if !*force {
+			fmt.Fprintf(os.Stderr, "ERROR, %s already exists with %s, use -force to replace it\n", QUIZ_FOLDER+filename, decks)
+			return 1
+		}
+		fmt.Printf("Replacing %s with %s\n", QUIZ_FOLDER+filename, decks)
+	}
+
+	if err := writeQuiz(QUIZ_FOLDER+filename, quiz); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR, Writing quiz file:", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d cards to %s\n", len(quiz.Deck), QUIZ_FOLDER+filename)
+
+	if *register {
+		if err := registerQuiz(*name, filename); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Registering quiz:", err)
+			return 1
+		}
+		fmt.Printf("Registered quiz '%s'\n", *name)
+	}
+
+	return 0
+}
+
+// Build a card out of an Anki note, returning false if the mapping finds no question or answers
+func (fm ankiFieldMap) Card(note ankiNote, separators string) (Card, bool) {
+
+	card := Card{
+		Question: note.Field(fm.Question),
+		Comment:  note.Field(fm.Comment),
+	}
+
+	for _, answer := range strings.FieldsFunc(note.Field(fm.Answers), func(r rune) bool {
+		return r == '\n' || strings.ContainsRune(separators, r)
+	}) {
+		if answer = strings.TrimSpace(answer); len(answer) > 0 {
+			card.Answers = append(card.Answers, answer)
+		}
+	}
+
+	return card, len(card.Question) > 0 && len(card.Answers) > 0
+}
+
+// Look up a note field by name or index, with HTML stripped
+func (n ankiNote) Field(key string) string {
+
+	if len(key) == 0 {
+		return ""
+	}
+
+	index := -1
+	for i, name := range n.Names {
+		if strings.EqualFold(name, key) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if i, err := strconv.Atoi(key); err == nil {
+			index = i
+		}
+	}
+
+	if index < 0 || index >= len(n.Fields) {
+		return ""
+	}
+
+	return stripAnkiHTML(n.Fields[index])
+}
+
+// Convert Anki field HTML into plain text
+func stripAnkiHTML(s string) string {
+	s = ankiSoundRegexp.ReplaceAllString(s, "")
+	s = ankiBreakRegexp.ReplaceAllString(s, "\n")
+	s = ankiTagRegexp.ReplaceAllString(s, "")
+	s = strings.Replace(html.UnescapeString(s), " ", " ", -1)
+
+	return strings.TrimSpace(s)
+}
+
+// Read notes from an Anki text export, with tab separated fields
+func readAnkiText(filename string) ([]ankiNote, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var notes []ankiNote
+	separator := "\t"
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Handle header lines of newer exports
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, "#separator:") {
+				switch strings.ToLower(strings.TrimPrefix(line, "#separator:")) {
+				case "comma":
+					separator = ","
+				case "semicolon":
+					separator = ";"
+				case "space":
+					separator = " "
+				case "pipe":
+					separator = "|"
+				}
+			}
+			continue
+		}
+
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		notes = append(notes, ankiNote{Fields: strings.Split(line, separator)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// Read notes from an Anki package, which is a zipped SQLite collection
+func readAnkiPackage(filename string) ([]ankiNote, error) {
+
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	// Prefer the newer collection format if present
+	var collection *zip.File
+	for _, f := range archive.File {
+		if f.Name == "collection.anki21" || (f.Name == "collection.anki2" && collection == nil) {
+			collection = f
+		}
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("No collection found in '%s'", filename)
+	}
+
+	// SQLite needs a real file to work with
+	tmp, err := ioutil.TempFile("", "kanjiquizbot-anki-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	rc, err := collection.Open()
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Figure out field names for every note type
+	var models string
+	if err := db.QueryRow("SELECT models FROM col").Scan(&models); err != nil {
+		return nil, err
+	}
+
+	var modelMap map[string]struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"flds"`
+	}
+	if err := json.Unmarshal([]byte(models), &modelMap); err != nil {
+		return nil, fmt.Errorf("Could not parse note types: %s", err)
+	}
+
+	fieldNames := make(map[string][]string, len(modelMap))
+	for id, model := range modelMap {
+		for _, field := range model.Fields {
+			fieldNames[id] = append(fieldNames[id], field.Name)
+		}
+	}
+
+	rows, err := db.Query("SELECT mid, flds FROM notes ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []ankiNote
+	for rows.Next() {
+		var mid int64
+		var flds string
+		if err := rows.Scan(&mid, &flds); err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, ankiNote{
+			Names:  fieldNames[strconv.FormatInt(mid, 10)],
+			Fields: strings.Split(flds, "\x1f"),
+		})
+	}
+
+	return notes, rows.Err()
+}
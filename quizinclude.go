@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Include pulls cards from another quiz, optionally filtered by card tags,
+// a "start:end" range of cards in file order and questions to leave out
+type Include struct {
+	Quiz    string   `json:"quiz" yaml:"quiz"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty,flow"`
+	Slice   string   `json:"slice,omitempty" yaml:"slice,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// Load quiz and recursively resolve its includes
+// The stack holds quizzes currently being resolved, for cycle detection
+func resolveQuiz(name string, stack []string) (Quiz, error) {
+
+	for _, parent := range stack {
+		if parent == name {
+			return Quiz{}, &IncludeError{Chain: append(append([]string{}, stack...), name), Err: fmt.Errorf("Quiz '%s' includes itself", name)}
+		}
+	}
+
+	quiz, err := readQuizFile(name)
+	quiz.Name = name
+	if err != nil || len(quiz.Include) == 0 {
+		return quiz, err
+	}
+	stack = append(stack, name)
+
+	// Own cards come first and take precedence over included ones
+	seen := make(map[string]bool, len(quiz.Deck))
+	for _, card := range quiz.Deck {
+		seen[card.Question] = true
+	}
+
+	for _, include := range quiz.Include {
+		included, err := resolveQuiz(include.Quiz, stack)
+		if err != nil {
+			return Quiz{}, err
+		}
+
+		cards, err := include.Filter(included.Deck)
+		if err != nil {
+			return Quiz{}, &IncludeError{Chain: append(append([]string{}, stack...), include.Quiz), Err: err}
+		}
+
+		for _, card := range cards {
+			if !seen[card.Question] {
+				seen[card.Question] = true
+				quiz.Deck = append(quiz.Deck, card)
+			}
+		}
+
+		// Inherit settings the including quiz doesn't override
+		if len(quiz.Description) == 0 {
+			quiz.Description = included.Description
+		}
+		if len(quiz.Type) == 0 {
+			quiz.Type = included.Type
+		}
+		if quiz.Timeout == 0 {
+			quiz.Timeout = included.Timeout
+		}
+
+		quiz.Included = append(quiz.Included, include.Quiz)
+		quiz.Included = append(quiz.Included, included.Included...)
+	}
+
+	quiz.Include = nil
+
+	return quiz, nil
+}
+
+// Returns the cards matching the include's slice range and tags, without excluded questions
+func (inc Include) Filter(deck []Card) ([]Card, error) {
+
+	if len(inc.Slice) > 0 {
+		start, end, err := parseSlice(inc.Slice, len(deck))
+		if err != nil {
+			return nil, err
+		}
+		deck = deck[start:end]
+	}
+
+	if len(inc.Tags) == 0 && len(inc.Exclude) == 0 {
+		return deck, nil
+	}
+
+	excluded := make(map[string]bool, len(inc.Exclude))
+	for _, question := range inc.Exclude {
+		excluded[question] = true
+	}
+
+	var result []Card
+	for _, card := range deck {
+		if excluded[card.Question] {
+			continue
+		}
+		if len(inc.Tags) == 0 {
+			result = append(result, card)
+			continue
+		}
+		for _, tag := range card.Tags {
+			if hasString(inc.Tags, tag) {
+				result = append(result, card)
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Parse a "start:end" range with optional ends, clamped to given length
+func parseSlice(s string, length int) (start int, end int, err error) {
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Malformed slice '%s', expected start:end", s)
+	}
+
+	start, end = 0, length
+	if len(parts[0]) > 0 {
+		if start, err = strconv.Atoi(parts[0]); err != nil || start < 0 {
+			return 0, 0, fmt.Errorf("Malformed slice start '%s'", parts[0])
+		}
+	}
+	if len(parts[1]) > 0 {
+		if end, err = strconv.Atoi(parts[1]); err != nil || end < 0 {
+			return 0, 0, fmt.Errorf("Malformed slice end '%s'", parts[1])
+		}
+	}
+
+	start, end = minint(start, length), minint(end, length)
+	if start > end {
+		return 0, 0, fmt.Errorf("Slice start %d is past end %d", start, end)
+	}
+
+	return start, end, nil
+}
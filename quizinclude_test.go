@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIncludeFilter(t *testing.T) {
+
+	deck := []Card{
+		{Question: "q1", Answers: []string{"a"}, Tags: []string{"noun"}},
+		{Question: "q2", Answers: []string{"b"}, Tags: []string{"verb"}},
+		{Question: "q3", Answers: []string{"c"}, Tags: []string{"noun"}},
+	}
+
+	cases := []struct {
+		Include  Include
+		Expected []string
+	}{
+		{Include{Quiz: "x"}, []string{"q1", "q2", "q3"}},
+		{Include{Quiz: "x", Slice: "1:"}, []string{"q2", "q3"}},
+		{Include{Quiz: "x", Slice: ":2"}, []string{"q1", "q2"}},
+		{Include{Quiz: "x", Slice: "0:100"}, []string{"q1", "q2", "q3"}},
+		{Include{Quiz: "x", Tags: []string{"noun"}}, []string{"q1", "q3"}},
+		{Include{Quiz: "x", Tags: []string{"noun"}, Slice: "1:3"}, []string{"q3"}},
+		{Include{Quiz: "x", Exclude: []string{"q2", "q4"}}, []string{"q1", "q3"}},
+		{Include{Quiz: "x", Tags: []string{"noun"}, Exclude: []string{"q1"}}, []string{"q3"}},
+	}
+
+	for _, c := range cases {
+		cards, err := c.Include.Filter(deck)
+		if err != nil {
+			t.Errorf("Filter %+v failed: %s", c.Include, err)
+			continue
+		}
+
+		var questions []string
+		for _, card := range cards {
+			questions = append(questions, card.Question)
+		}
+		if !cmp.Equal(questions, c.Expected) {
+			t.Errorf("Filter %+v returned %v, expected %v", c.Include, questions, c.Expected)
+		}
+	}
+
+	if _, err := (Include{Quiz: "x", Slice: "2:1"}).Filter(deck); err == nil {
+		t.Error("Filter should reject reversed slice")
+	}
+}
+
+func TestIncludeResolve(t *testing.T) {
+
+	files := map[string]string{
+		"_include_base": `{ "description": "Base", "type": "text", "deck": [
+			{ "question": "q1", "answers": [ "a" ] },
+			{ "question": "q2", "answers": [ "b" ] } ] }`,
+		"_include_blob": `{ "description": "Blob", "include": [ { "quiz": "_include_base" } ], "deck": [
+			{ "question": "q2", "answers": [ "own" ] } ] }`,
+		"_include_cycle_a": `{ "description": "A", "include": [ { "quiz": "_include_cycle_b" } ] }`,
+		"_include_cycle_b": `{ "description": "B", "include": [ { "quiz": "_include_cycle_a" } ] }`,
+		"_include_slice":   `{ "description": "Slice", "include": [ { "quiz": "_include_base", "slice": "2:1" } ] }`,
+		"_include_dupes": `{ "description": "Dupes", "include": [ { "quiz": "_include_base" } ], "deck": [
+			{ "question": "q3", "answers": [ "c", "c" ] } ] }`,
+	}
+
+	loadQuizList()
+	for name, data := range files {
+		if err := ioutil.WriteFile(QUIZ_FOLDER+name+".json", []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(QUIZ_FOLDER + name + ".json")
+
+		Quizzes.Lock()
+		Quizzes.Map[name] = QuizInfo{File: name + ".json"}
+		Quizzes.Unlock()
+	}
+
+	quiz, err := resolveQuiz("_include_blob", nil)
+	if err != nil {
+		t.Fatalf("Resolving includes failed: %s", err)
+	}
+
+	expected := []Card{
+		{Question: "q2", Answers: []string{"own"}},
+		{Question: "q1", Answers: []string{"a"}},
+	}
+	if !cmp.Equal(quiz.Deck, expected) || quiz.Type != "text" || quiz.Description != "Blob" {
+		t.Errorf("Resolved quiz mismatch: %+v", quiz)
+	}
+
+	// Fixes of composed quizzes go into the quizzes they include, so no fixed copy gets written
+	for _, report := range ValidateQuizzes([]string{"_include_dupes"}, true) {
+		if len(report.Fixed) > 0 || report.Skipped != "Composed from _include_base, fix those instead" {
+			os.Remove(report.Fixed)
+			t.Errorf("Composed quiz fix report mismatch: %+v", report)
+		}
+	}
+
+	_, err = resolveQuiz("_include_cycle_a", nil)
+	if e, ok := err.(*IncludeError); !ok || !cmp.Equal(e.Chain, []string{"_include_cycle_a", "_include_cycle_b", "_include_cycle_a"}) {
+		t.Errorf("Expected include cycle error, got %#v", err)
+	}
+
+	_, err = LoadQuiz("_include_slice")
+	if e, ok := err.(*IncludeError); !ok || !cmp.Equal(e.Chain, []string{"_include_slice", "_include_base"}) {
+		t.Errorf("Expected include filter error, got %#v", err)
+	}
+}
+
+func TestBlobDecksUnchanged(t *testing.T) {
+
+	// Digests of the questions, answers and comments of the blob decks as they were before includes,
+	// so they keep playing the same if they get composed from other decks again
+	expected := map[string]string{
+		"jlpt_blob":   "eab257f4ac2dbc064d11d52841df5e139add3d133a4fed7e4a6e91e719c06d18",
+		"kanken_blob": "478b093769fe1e7b5fd18ddd5c869b2f2093872013868634ac6861a8a5046efa",
+	}
+
+	loadQuizList()
+	for name, digest := range expected {
+		quiz, err := LoadQuiz(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := sha256.New()
+		for _, card := range quiz.Deck {
+			fmt.Fprintf(h, "%q %q %q\n", card.Question, card.Answers, card.Comment)
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != digest {
+			t.Errorf("Deck '%s' with %d cards changed, digest %s", name, len(quiz.Deck), sum)
+		}
+	}
+}
@@ -2,33 +2,142 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+
+	"github.com/bwmarrin/discordgo"
 )
 
 const QUIZ_FOLDER = "./quizzes/"
 
-// Quiz List filename container
+// Quiz List container, keyed by quiz name
 var Quizzes struct {
 	sync.RWMutex
-	Map map[string]string
+	Map map[string]QuizInfo
+}
+
+// Quiz List entry with deck filename and metadata
+type QuizInfo struct {
+	File       string `json:"file"`
+	Category   string `json:"category,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"` // easy, normal or hard
+	Language   string `json:"language,omitempty"`   // question-answer language pair, e.g. ja-ja
+	NSFW       bool   `json:"nsfw,omitempty"`
+	Hidden     bool   `json:"hidden,omitempty"` // Playable, but left out of help and list
+}
+
+// Quiz List categories in display order, decks without a known one are shown as "Various"
+var QuizCategories = []string{"Educational", "Name", "Various"}
+
+// Accept both a plain filename and a full metadata object as Quiz List entry
+func (qi *QuizInfo) UnmarshalJSON(data []byte) error {
+
+	var filename string
+	if err := json.Unmarshal(data, &filename); err == nil {
+		*qi = QuizInfo{File: filename}
+		return nil
+	}
+
+	// Use an alias type to avoid recursing into this method
+	type quizInfo QuizInfo
+	return json.Unmarshal(data, (*quizInfo)(qi))
+}
+
+// Returns the display category of the quiz
+func (qi QuizInfo) CategoryName() string {
+	if !hasString(QuizCategories, qi.Category) {
+		return "Various"
+	}
+	return qi.Category
+}
+
+// Returns the notes shown next to the quiz name in the list, leaving out the usual ja-ja language
+func (qi QuizInfo) Labels() []string {
+	var labels []string
+	if len(qi.Language) > 0 && qi.Language != "ja-ja" {
+		labels = append(labels, qi.Language)
+	}
+	if len(qi.Author) > 0 {
+		labels = append(labels, "by "+qi.Author)
+	}
+	if qi.NSFW {
+		labels = append(labels, "nsfw")
+	}
+
+	return labels
 }
 
 // Quiz struct to hold entire quiz data
 type Quiz struct {
-	Description string `json:"description"`
-	Type        string `json:"type,omitempty"`
-	Timeout     int    `json:"timeout,omitempty"`
-	Deck        []Card `json:"deck"`
+	Description string    `json:"description" yaml:"description"`
+	Type        string    `json:"type,omitempty" yaml:"type,omitempty"`
+	Timeout     int       `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Order       string    `json:"order,omitempty" yaml:"order,omitempty"`
+	ImageSize   int       `json:"image_size,omitempty" yaml:"image_size,omitempty"`
+	ImageCrop   bool      `json:"image_crop,omitempty" yaml:"image_crop,omitempty"`
+	Distort     bool      `json:"distort,omitempty" yaml:"distort,omitempty"`
+	Font        string    `json:"font,omitempty" yaml:"font,omitempty"`
+	Vertical    bool      `json:"vertical,omitempty" yaml:"vertical,omitempty"`
+	Ruby        bool      `json:"ruby,omitempty" yaml:"ruby,omitempty"`
+	Include     []Include `json:"include,omitempty" yaml:"include,omitempty"`
+	SkipChecks  []string  `json:"skip_checks,omitempty" yaml:"skip_checks,omitempty,flow"` // Validators not run on the deck
+	Deck        []Card    `json:"deck" yaml:"deck"`
+	Included    []string  `json:"-" yaml:"-"` // Names of quizzes resolved into the deck
+	Name        string    `json:"-" yaml:"-"` // Quiz List name the quiz was loaded as
 }
 
+// Supported deck playback orders
+var DeckOrders = []string{"shuffle", "sequential", "reverse", "chunks", "hardest"}
+
+// Default card count per chunk for the "chunks" order
+const DEFAULT_CHUNK_SIZE = 10
+
 // Card struct to hold question-answer set
 type Card struct {
-	Question string   `json:"question"`
-	Answers  []string `json:"answers"`
-	Comment  string   `json:"comment,omitempty"`
+	Question   string   `json:"question" yaml:"question"`
+	Answers    []string `json:"answers" yaml:"answers,flow"`
+	Comment    string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Difficulty int      `json:"difficulty,omitempty" yaml:"difficulty,omitempty"`
+	Weight     float64  `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Tags       []string `json:"tags,omitempty" yaml:"tags,omitempty,flow"`
+	Source     string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Type       string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Image      string   `json:"image,omitempty" yaml:"image,omitempty"`
+	Context    string   `json:"context,omitempty" yaml:"context,omitempty"`
+	Furigana   string   `json:"furigana,omitempty" yaml:"furigana,omitempty"`
+}
+
+// Returns the question type of a card, falling back to the quiz type
+func (q Quiz) CardType(c Card) string {
+	if len(c.Type) > 0 {
+		return c.Type
+	}
+
+	return q.Type
+}
+
+// Card metadata limits
+const CARD_DIFFICULTY_MAX = 5
+const CARD_WEIGHT_MAX = 100.0
+
+// Sampling weight of a card, defaulting to 1 when unset
+func (c Card) SampleWeight() float64 {
+	if c.Weight <= 0 {
+		return 1
+	}
+
+	return c.Weight
 }
 
 // English Dictionary slice
@@ -44,17 +153,83 @@ func loadQuizList() error {
 	}
 	defer file.Close()
 
+	// Decode into a new map, so a broken file keeps the old list in use
+	quizMap := make(map[string]QuizInfo)
+	if err := json.NewDecoder(file).Decode(&quizMap); err != nil {
+		log.Println("ERROR, Unmarshalling Quiz List json: ", err)
+		return err
+	}
+
 	Quizzes.Lock()
-	// Clear old map first
-	Quizzes.Map = make(map[string]string)
-	err = json.NewDecoder(file).Decode(&Quizzes.Map)
+	Quizzes.Map = quizMap
 	Quizzes.Unlock()
+
+	return nil
+}
+
+// Returns the names of quizzes in the Quiz List file on disk that use given quiz file, sorted
+func quizzesWithFile(filename string) []string {
+
+	var list map[string]QuizInfo
+	data, err := ioutil.ReadFile(RESOURCES_FOLDER + "quizlist.json")
+	if err == nil {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil {
+		log.Println("ERROR, Reading Quiz List:", err)
+		return nil
+	}
+
+	var names []string
+	for name, info := range list {
+		if info.File == filename {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Add a quiz to the Quiz List file on disk, keeping its hand-made layout intact
+func registerQuiz(name string, filename string) error {
+
+	data, err := ioutil.ReadFile(RESOURCES_FOLDER + "quizlist.json")
 	if err != nil {
-		log.Println("ERROR, Unmarshalling Quiz List json: ", err)
 		return err
 	}
 
-	return nil
+	// Nothing to do if it's already registered
+	var list map[string]QuizInfo
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	if current, exists := list[name]; exists {
+		if current.File != filename {
+			return fmt.Errorf("Quiz '%s' already registered as '%s'", name, current.File)
+		}
+		return nil
+	}
+
+	// Insert new entry before the closing brace
+	end := bytes.LastIndexByte(data, '}')
+	if end < 0 {
+		return fmt.Errorf("Malformed Quiz List file")
+	}
+	head := bytes.TrimRight(data[:end], " \t\r\n")
+	entry := fmt.Sprintf("%q:\t{ \"file\": %q }", name, filename)
+	if len(list) > 0 {
+		entry = ",\n\t" + entry
+	} else {
+		entry = "\n\t" + entry
+	}
+
+	var buf bytes.Buffer
+	buf.Write(head)
+	buf.WriteString(entry)
+	buf.WriteString("\n}\n")
+
+	return ioutil.WriteFile(RESOURCES_FOLDER+"quizlist.json", buf.Bytes(), 0644)
 }
 
 // Load up English dictionary for Scramble quiz
@@ -89,6 +264,15 @@ func loadScrambleDictionary() {
 
 }
 
+// Returns Quiz List metadata for given quiz
+func GetQuizInfo(name string) (QuizInfo, bool) {
+	Quizzes.RLock()
+	info, ok := Quizzes.Map[name]
+	Quizzes.RUnlock()
+
+	return info, ok
+}
+
 // Returns a slice of quiz names
 func GetQuizlist() []string {
 	var quizlist []string
@@ -101,29 +285,118 @@ func GetQuizlist() []string {
 	return quizlist
 }
 
-// Returns a slice of shuffled Questions from a given quiz
-func LoadQuiz(name string) (quiz Quiz) {
+// Returns a sorted slice of quiz names whose metadata matches the filter
+func GetQuizlistBy(filter func(QuizInfo) bool) []string {
+	var quizlist []string
+	Quizzes.RLock()
+	for k, info := range Quizzes.Map {
+		if filter(info) {
+			quizlist = append(quizlist, k)
+		}
+	}
+	Quizzes.RUnlock()
+
+	sort.Strings(quizlist)
+	return quizlist
+}
+
+// Returns a given quiz with its includes resolved and its deck in file order
+// Errors are one of UnknownQuizError, MissingFileError, ParseError, IncludeError or EmptyQuizError
+func LoadQuiz(name string) (Quiz, error) {
+
+	quiz, err := resolveQuiz(name, nil)
+	if err == nil && len(quiz.Deck) == 0 {
+		err = &EmptyQuizError{Name: name}
+	}
+
+	return quiz, err
+}
+
+// Read a single quiz file, served from the deck cache unless it changed on disk
+func readQuizFile(name string) (Quiz, error) {
 
 	Quizzes.RLock()
-	filename, ok := Quizzes.Map[name]
+	info, ok := Quizzes.Map[name]
 	Quizzes.RUnlock()
 
-	if ok {
-		file, err := os.Open(QUIZ_FOLDER + filename)
-		if err != nil {
-			log.Printf("ERROR, Reading json '%s': %s\n", name, err)
-			return
+	if !ok {
+		return Quiz{}, &UnknownQuizError{Name: name, Suggestions: suggestQuizzes(name)}
+	}
+
+	return cachedQuizFile(name, info.File)
+}
+
+// Returns true for deck orders arrangeDeck knows, an empty order being the default shuffle
+func isDeckOrder(order string) bool {
+	return len(order) == 0 || hasString(DeckOrders, order)
+}
+
+// Tell the channel about an unknown deck order given as quiz option, returns false if there was one
+func checkOrderOption(s *discordgo.Session, cid string, opts map[string]string) bool {
+	if order, ok := opts["order"]; ok && !isDeckOrder(order) {
+		msgSend(s, cid, fmt.Sprintf("Error: Unknown order '%s', available orders: %s", order, strings.Join(DeckOrders, ", ")))
+		return false
+	}
+
+	return true
+}
+
+// Arrange quiz deck in playback order, with options given overriding the deck's own order
+func arrangeDeck(name string, quiz *Quiz, opts map[string]string) {
+
+	order := quiz.Order
+	if o, ok := opts["order"]; ok {
+		order = o
+	}
+
+	switch order {
+	case "sequential":
+		// Keep file order as is
+	case "reverse":
+		for l, r := 0, len(quiz.Deck)-1; l < r; l, r = l+1, r-1 {
+			quiz.Deck[l], quiz.Deck[r] = quiz.Deck[r], quiz.Deck[l]
+		}
+	case "chunks":
+		size := DEFAULT_CHUNK_SIZE
+		if i, err := strconv.Atoi(opts["chunk"]); err == nil && i > 0 {
+			size = i
 		}
-		defer file.Close()
 
-		err = json.NewDecoder(file).Decode(&quiz)
-		if err != nil {
-			log.Printf("ERROR, Unmarshalling json '%s': %s\n", name, err)
-			return Quiz{}
+		for i := 0; i < len(quiz.Deck); i += size {
+			shuffle(quiz.Deck[i:minint(i+size, len(quiz.Deck))])
 		}
+	case "hardest":
+		// Shuffle first so cards with equal miss rates come in random order
+		shuffle(quiz.Deck)
+		sort.SliceStable(quiz.Deck, func(i, j int) bool {
+			return getStat(name, quiz.Deck[i].Question).MissRate() > getStat(name, quiz.Deck[j].Question).MissRate()
+		})
+	default:
+		weightedShuffle(quiz.Deck)
+	}
+}
+
+// Shuffle deck by weighted sampling without replacement, so heavier cards tend to come up earlier
+func weightedShuffle(deck []Card) {
+
+	// Every card gets a random key of u^(1/weight), then sort by descending key
+	keys := make([]float64, len(deck))
+	for i, card := range deck {
+		keys[i] = math.Pow(rand.Float64(), 1/card.SampleWeight())
 	}
 
-	shuffle(quiz.Deck)
+	sort.Sort(byKey{deck, keys})
+}
+
+// Sort helper for ordering a deck by precomputed keys, highest first
+type byKey struct {
+	deck []Card
+	keys []float64
+}
 
-	return
+func (b byKey) Len() int           { return len(b.deck) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.deck[i], b.deck[j] = b.deck[j], b.deck[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
 }
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marker of readings outside the jouyou reading table in the kanji info
+const NON_JOUYOU_MARKER = "【△】"
+
+// Most reading combinations tried when looking for the closest one to a typo
+const READING_COMBINATIONS_MAX = 5000
+
+// Shortest answer in kana that gets checked for typos, shorter ones are too often irregular readings
+const TYPO_LENGTH_MIN = 4
+
+// Share of composable answers below which a quiz is not about kanji readings, like radical names
+const READING_MATCH_RATIO = 0.5
+
+// Share of single kanji cards that makes a quiz count as a kanji reading list
+const KANJI_LIST_RATIO = 0.9
+
+// Voiced forms a kana can take through rendaku
+var rendakuKana = map[rune][]rune{
+	'か': {'が'}, 'き': {'ぎ'}, 'く': {'ぐ'}, 'け': {'げ'}, 'こ': {'ご'},
+	'さ': {'ざ'}, 'し': {'じ'}, 'す': {'ず'}, 'せ': {'ぜ'}, 'そ': {'ぞ'},
+	'た': {'だ'}, 'ち': {'ぢ', 'じ'}, 'つ': {'づ', 'ず'}, 'て': {'で'}, 'と': {'ど'},
+	'は': {'ば', 'ぱ'}, 'ひ': {'び', 'ぴ'}, 'ふ': {'ぶ', 'ぷ'}, 'へ': {'べ', 'ぺ'}, 'ほ': {'ぼ', 'ぽ'},
+}
+
+// Vowel-initial kana and their form after ん through renjō, as in 反応
+var renjouKana = map[rune]rune{'あ': 'な', 'い': 'に', 'う': 'ぬ', 'え': 'ね', 'お': 'の'}
+
+// Verb endings and their continuative form, as in 入る and 入口
+var continuativeKana = map[rune]rune{
+	'う': 'い', 'く': 'き', 'ぐ': 'ぎ', 'す': 'し', 'つ': 'ち', 'ぬ': 'に', 'ぶ': 'び', 'む': 'み', 'る': 'り',
+}
+
+// Final kana that turn into a small つ through gemination
+var geminatingKana = []rune{'つ', 'ち', 'く', 'き'}
+
+// Kana by consonant and vowel, with ・ where a sound is missing
+var kanaRows = []string{
+	"あいうえお", "かきくけこ", "がぎぐげご", "さしすせそ", "ざじずぜぞ", "たちつてと", "だぢづでど", "なにぬねの",
+	"はひふへほ", "ばびぶべぼ", "ぱぴぷぺぽ", "まみむめも", "や・ゆ・よ", "らりるれろ", "わ・・・を",
+}
+
+// Checks that answers of reading quizzes can be composed from the readings of their kanji,
+// and that single kanji cards list all of their jouyou readings
+type readingValidator struct{}
+
+func (v readingValidator) Name() string { return "readings" }
+
+func (v readingValidator) Check(quiz Quiz) (issues []Issue) {
+	if len(KanjiMap) == 0 || !isReadingQuiz(quiz) {
+		return
+	}
+
+	// Names are read however their owners like
+	if info, ok := GetQuizInfo(quiz.Name); ok && info.CategoryName() == "Name" {
+		return
+	}
+
+	// Figure out which answers can't be composed first, to tell whether the quiz is about readings at all
+	var total, unmatchedCount int
+	unmatched := make([][]string, len(quiz.Deck))
+	segmented := make([][][]string, len(quiz.Deck))
+	for i, card := range quiz.Deck {
+		segments, ok := segmentReadings(card.Question)
+		if !ok {
+			continue
+		}
+		segmented[i] = segments
+
+		for _, answer := range card.Answers {
+			total++
+			if !composable(segments, k2h(answer)) {
+				unmatched[i] = append(unmatched[i], answer)
+				unmatchedCount++
+			}
+		}
+	}
+	if float64(total-unmatchedCount) < float64(total)*READING_MATCH_RATIO {
+		return
+	}
+
+	// Irregular readings like jukujikun often show up on cards of their own
+	deckReadings := make(map[string][]string, len(quiz.Deck))
+	for _, card := range quiz.Deck {
+		for _, answer := range card.Answers {
+			deckReadings[card.Question] = append(deckReadings[card.Question], k2h(answer))
+		}
+	}
+
+	kanjiList := isKanjiList(quiz)
+	for i, card := range quiz.Deck {
+		segments := segmented[i]
+		if segments == nil {
+			continue
+		}
+
+		// Uncomposed answers are mostly irregular readings, so they only make notices
+		for _, answer := range unmatched[i] {
+			if utf8.RuneCountInString(answer) < TYPO_LENGTH_MIN || readFromDeck(card.Question, k2h(answer), deckReadings) {
+				issues = append(issues, newIssue(v, SEVERITY_NOTICE, card.Question, "Found answer %s not composed from known readings", answer))
+			} else if closest, ok := closestReading(segments, k2h(answer)); ok {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found answer %s that looks like a typo of %s", answer, closest))
+			} else {
+				issues = append(issues, newIssue(v, SEVERITY_NOTICE, card.Question, "Found answer %s not composed from known readings", answer))
+			}
+		}
+
+		if kanjiList && len(segments) == 1 {
+			if missing := missingReadings(KanjiMap[card.Question], card.Answers); len(missing) > 0 {
+				issues = append(issues, newIssue(v, SEVERITY_WARNING, card.Question, "Found missing jouyou readings: %s", strings.Join(missing, ", ")))
+			}
+		}
+	}
+
+	return
+}
+
+// Returns true if the reading is given for another question of the deck, as a whole
+// or for a word of at least two characters within the question, allowing for rendaku
+func readFromDeck(question string, reading string, deckReadings map[string][]string) bool {
+
+	for other, readings := range deckReadings {
+		if other == question {
+			continue
+		}
+		within := utf8.RuneCountInString(other) >= 2 && strings.Contains(question, other)
+		for _, r := range readings {
+			if r == reading {
+				return true
+			}
+			if !within || len(r) == 0 {
+				continue
+			}
+			variants := []string{r}
+			runes := []rune(r)
+			for _, voiced := range rendakuKana[runes[0]] {
+				variants = append(variants, string(voiced)+string(runes[1:]))
+			}
+			for _, variant := range variants {
+				if strings.Contains(reading, variant) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Split a question into reading candidates per character
+// Kana stand for themselves and 々 repeats the previous kanji, other characters make the question unsuitable
+func segmentReadings(question string) ([][]string, bool) {
+
+	runes := []rune(question)
+	segments := make([][]string, 0, len(runes))
+	for i, r := range runes {
+		first, last := i == 0, i == len(runes)-1
+
+		switch {
+		case r == 'ヶ' || r == 'ヵ':
+			// Counter ke, as in 一ヶ月
+			segments = append(segments, []string{"か", "が", "こ"})
+		case isKana(string(r)):
+			segments = append(segments, []string{k2h(string(r))})
+		case r == '々' && i > 0 && unicode.Is(unicode.Han, runes[i-1]):
+			segments = append(segments, readingVariants(KanjiMap[string(runes[i-1])], first, last))
+		case unicode.Is(unicode.Han, r):
+			kanji, ok := KanjiMap[string(r)]
+			if !ok {
+				return nil, false
+			}
+			segments = append(segments, readingVariants(kanji, first, last))
+		default:
+			return nil, false
+		}
+	}
+
+	return segments, len(segments) > 0
+}
+
+// Returns the readings a kanji can take at a position in a word,
+// with rendaku and renjō when not first and gemination when not last
+func readingVariants(kanji Kanji, first bool, last bool) []string {
+
+	set := NewStringSet()
+	for reading := range kanjiReadings(kanji) {
+		if len(reading) == 0 {
+			continue
+		}
+		set.Add(reading)
+
+		runes := []rune(reading)
+		if !first {
+			for _, voiced := range rendakuKana[runes[0]] {
+				set.Add(string(voiced) + string(runes[1:]))
+			}
+			if n, ok := renjouKana[runes[0]]; ok {
+				set.Add(string(n) + string(runes[1:]))
+			}
+		}
+		if !last && len(runes) > 1 {
+			for _, r := range geminatingKana {
+				if runes[len(runes)-1] == r {
+					set.Add(string(runes[:len(runes)-1]) + "っ")
+				}
+			}
+		}
+	}
+
+	return set.Values()
+}
+
+// Returns true if the reading can be split into one candidate of every segment, in order
+func composable(segments [][]string, reading string) bool {
+
+	// Offsets in the reading reachable after matching the segments so far
+	offsets := map[int]bool{0: true}
+	for _, candidates := range segments {
+		next := make(map[int]bool)
+		for offset := range offsets {
+			for _, candidate := range candidates {
+				if strings.HasPrefix(reading[offset:], candidate) {
+					next[offset+len(candidate)] = true
+				}
+			}
+		}
+		if len(next) == 0 {
+			return false
+		}
+		offsets = next
+	}
+
+	return offsets[len(reading)]
+}
+
+// Returns the composed reading one edit away from the given one, if there is exactly such a reading
+// and the edit leaves some of every character's reading in place
+// Words with too many reading combinations are skipped
+func closestReading(segments [][]string, reading string) (string, bool) {
+
+	combinations := 1
+	for _, candidates := range segments {
+		combinations *= len(candidates)
+		if combinations > READING_COMBINATIONS_MAX {
+			return "", false
+		}
+	}
+
+	// Composed readings one edit away, and whether any way of composing them makes the edit a likely typo
+	closest := make(map[string]bool)
+	ends := make([]int, len(segments))
+	var compose func(i int, prefix string)
+	compose = func(i int, prefix string) {
+		if i == len(segments) {
+			if editDistance(prefix, reading) == 1 {
+				closest[prefix] = closest[prefix] || isTypoEdit([]rune(prefix), ends, []rune(reading))
+			}
+			return
+		}
+		for _, candidate := range segments[i] {
+			ends[i] = utf8.RuneCountInString(prefix + candidate)
+			compose(i+1, prefix+candidate)
+		}
+	}
+	compose(0, "")
+
+	// Several equally close readings make it more likely to be a different word than a typo
+	if len(closest) != 1 {
+		return "", false
+	}
+	for composed, typo := range closest {
+		return composed, typo
+	}
+
+	return "", false
+}
+
+// Returns true if a reading one edit away from the composed one looks like a typo,
+// given where each character's reading ends in the composed one
+// The edit has to keep part of every character's reading and stay clear of the kana where two readings meet,
+// which change with rendaku, gemination and vowel shifts. Edits of doubled or nasal sounds, lengthened vowels
+// and the last kana of a word are more likely irregular or colloquial readings than typos too
+func isTypoEdit(composed []rune, ends []int, reading []rune) bool {
+
+	p := 0
+	for p < len(composed) && p < len(reading) && composed[p] == reading[p] {
+		p++
+	}
+
+	// Length of the reading of the character at a position in the composed reading
+	segmentLength := func(pos int) int {
+		start := 0
+		for _, end := range ends {
+			if pos < end {
+				return end - start
+			}
+			start = end
+		}
+		return 0
+	}
+	atJoint := func(pos int) bool {
+		for _, end := range ends[:len(ends)-1] {
+			if pos == end-1 || pos == end {
+				return true
+			}
+		}
+		return false
+	}
+	lengthening := func(runes []rune, pos int) bool {
+		return runes[pos] == 'ー' || (pos > 0 && runes[pos] == 'う')
+	}
+	doubled := func(runes []rune, pos int) bool {
+		return runes[pos] == 'っ' || runes[pos] == 'ん' || (pos > 0 && runes[pos] == runes[pos-1]) || (pos+1 < len(runes) && runes[pos] == runes[pos+1])
+	}
+
+	vowel := func(r rune) bool {
+		return strings.ContainsRune("あいうえお", r)
+	}
+
+	switch {
+	case len(reading) == len(composed):
+		return !doubled(composed, p) && !doubled(reading, p) && reading[p] != 'ー' && !atJoint(p) && segmentLength(p) > 1 &&
+			isKanaTypo(composed[p], reading[p])
+	case len(reading) > len(composed):
+		return p > 0 && p < len(composed) && vowel(reading[p]) && !doubled(reading, p) && !lengthening(reading, p) && !atJoint(p-1) && !atJoint(p)
+	default:
+		return p < len(composed)-1 && vowel(composed[p]) && !doubled(composed, p) && !lengthening(composed, p) && !atJoint(p) && segmentLength(p) > 1
+	}
+}
+
+// Returns true if one kana could be typed for another by hitting one wrong key in romaji input,
+// keeping either the consonant or the vowel
+// Kana that only differ by voicing, like か and が or ず and づ, are reading variants rather than typos
+func isKanaTypo(a rune, b rune) bool {
+
+	for base, voiced := range rendakuKana {
+		if (a == base || strings.ContainsRune(string(voiced), a)) && (b == base || strings.ContainsRune(string(voiced), b)) {
+			return false
+		}
+	}
+
+	rowA, columnA, rowB, columnB := -1, -1, -1, -1
+	for i, row := range kanaRows {
+		for j, r := range []rune(row) {
+			switch r {
+			case a:
+				rowA, columnA = i, j
+			case b:
+				rowB, columnB = i, j
+			}
+		}
+	}
+	if rowA < 0 || rowB < 0 {
+		return false
+	}
+
+	return rowA == rowB || columnA == columnB
+}
+
+// Returns the jouyou readings of a kanji that none of the answers cover, in kanji info order
+func missingReadings(kanji Kanji, answers []string) []string {
+
+	covered := make(map[string]bool, len(answers))
+	for _, answer := range answers {
+		covered[k2h(answer)] = true
+	}
+
+	var missing []string
+	for _, reading := range readingList(kanji) {
+		if strings.HasPrefix(reading, NON_JOUYOU_MARKER) {
+			continue
+		}
+
+		reading = k2h(cleanReading(reading))
+		full := strings.Replace(reading, "･", "", -1)
+		stem := strings.Split(reading, "･")[0]
+		if !covered[full] && !covered[stem] && !hasString(missing, full) {
+			missing = append(missing, full)
+		}
+	}
+
+	return missing
+}
+
+// Returns the set of hiragana readings of a kanji
+// Kun readings are included with any part of their okurigana, and in the continuative form for compounds
+func kanjiReadings(kanji Kanji) map[string]bool {
+
+	list := readingList(kanji)
+	readings := make(map[string]bool, 2*len(list))
+	for _, reading := range list {
+		parts := strings.SplitN(k2h(cleanReading(reading)), "･", 2)
+		readings[parts[0]] = true
+		if len(parts) < 2 {
+			continue
+		}
+
+		okurigana := []rune(parts[1])
+		for i := 1; i <= len(okurigana); i++ {
+			readings[parts[0]+string(okurigana[:i])] = true
+		}
+		if i, ok := continuativeKana[okurigana[len(okurigana)-1]]; ok {
+			readings[parts[0]+string(okurigana[:len(okurigana)-1])+string(i)] = true
+		}
+	}
+
+	return readings
+}
+
+// Returns the on and kun readings of a kanji in one new slice
+func readingList(kanji Kanji) []string {
+	list := make([]string, 0, len(kanji.On)+len(kanji.Kun))
+	list = append(list, kanji.On...)
+	return append(list, kanji.Kun...)
+}
+
+// Strip usage markers like 【△】 and affix dashes from a reading
+func cleanReading(reading string) string {
+	if i := strings.Index(reading, "】"); i >= 0 {
+		reading = reading[i+len("】"):]
+	}
+
+	return strings.Trim(reading, "-－ ")
+}
+
+// Returns true if most cards of the quiz ask for a single kanji
+func isKanjiList(quiz Quiz) bool {
+	var single int
+	for _, card := range quiz.Deck {
+		if runes := []rune(card.Question); len(runes) == 1 && unicode.Is(unicode.Han, runes[0]) {
+			single++
+		}
+	}
+
+	return len(quiz.Deck) > 0 && float64(single) >= float64(len(quiz.Deck))*KANJI_LIST_RATIO
+}
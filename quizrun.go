@@ -11,7 +11,7 @@ import (
 )
 
 // Run kanji quiz loop in given channel
-func runQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int) {
+func runQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, opts map[string]string, waitTimeGiven int, pauseTimeGiven int) {
 
 	// Mark the quiz as started
 	if err := startQuiz(s, quizChannel); err != nil {
@@ -32,10 +32,16 @@ func runQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimit
 		quiz = getReview(quizChannel)
 		winLimit = len(quiz.Deck)
 	} else {
-		quiz = LoadQuiz(quizname)
+		var err error
+		if quiz, err = LoadQuiz(quizname); err != nil {
+			reportLoadError(s, quizChannel, err)
+			stopQuiz(s, quizChannel)
+			return
+		}
+		arrangeDeck(quizname, &quiz, opts)
 	}
 	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find valid quiz: "+quizname)
+		msgSend(s, quizChannel, "Nothing to review in this channel!")
 		stopQuiz(s, quizChannel)
 		return
 	}
@@ -91,14 +97,19 @@ func runQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimit
 	var questionTitle string
 	players := make(map[string]int)
 	var timeoutCount int
+	render := quizRenderOptions(quiz, opts)
 
 outer:
 	for len(quiz.Deck) > 0 {
 		time.Sleep(pauseTime)
 
-		// Grab new word from the quiz
+		// Grab new word from the quiz, reviews going from the most recently missed card back
 		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
+		if quizname == "review" {
+			current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
+		} else {
+			current, quiz.Deck = quiz.Deck[0], quiz.Deck[1:]
+		}
 
 		// Replace readings with hiragana-only version
 		answers := make([]string, len(current.Answers))
@@ -107,7 +118,7 @@ outer:
 		}
 
 		// Add word to quiz history
-		if (quiz.Type == "text" || quiz.Type == "url") && len(current.Answers) > 0 {
+		if cardType := quiz.CardType(current); (cardType == "text" || cardType == "url" || cardType == "image") && len(current.Answers) > 0 {
 			quizHistory = append(quizHistory, current.Answers[0])
 			questionTitle = ""
 		} else {
@@ -124,16 +135,11 @@ outer:
 		}
 
 		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
+		render.Countdown = time.Duration(timeout) * time.Second
+		sendQuestion(s, quizChannel, quiz, current, render)
 
 		// Set timeout for no correct answers
-		timeoutChan := time.NewTimer(time.Duration(timeout) * time.Second)
+		timeoutChan := time.NewTimer(render.Countdown)
 
 	inner:
 		for {
@@ -164,14 +170,8 @@ outer:
 					Color:       0xAA2222,
 				}
 
-				if len(current.Comment) > 0 {
-					embed.Fields = []*discordgo.MessageEmbedField{
-						&discordgo.MessageEmbedField{
-							Name:   "Comment",
-							Value:  truncate(current.Comment, 1024),
-							Inline: false,
-						}}
-				}
+				// Add comment and card details
+				embed.Fields = append(embed.Fields, cardFields(current)...)
 
 				embedSend(s, quizChannel, embed)
 
@@ -207,6 +207,11 @@ outer:
 			}
 		}
 
+		// Record round outcome for difficulty ordering
+		if quizname != "review" {
+			recordStat(quizname, current.Question, len(scoreKeeper) == 0)
+		}
+
 		if len(scoreKeeper) > 0 {
 
 			winnerExists := false
@@ -239,13 +244,8 @@ outer:
 					}},
 			}
 
-			if len(current.Comment) > 0 {
-				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-					Name:   "Comment",
-					Value:  truncate(current.Comment, 1024),
-					Inline: false,
-				})
-			}
+			// Add comment and card details
+			embed.Fields = append(embed.Fields, cardFields(current)...)
 
 			embedSend(s, quizChannel, embed)
 
@@ -259,6 +259,9 @@ outer:
 	// Clean up
 	killHandler()
 
+	// Save recorded card statistics
+	writeStats()
+
 	// Produce scoreboard
 	fields := make([]*discordgo.MessageEmbedField, 0, 2)
 	var winners string
@@ -318,7 +321,7 @@ outer:
 }
 
 // Run multi quiz loop in given channel
-func runMultiQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int) {
+func runMultiQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, opts map[string]string, waitTimeGiven int, pauseTimeGiven int) {
 
 	// Mark the quiz as started
 	if err := startQuiz(s, quizChannel); err != nil {
@@ -335,12 +338,13 @@ func runMultiQuiz(s *discordgo.Session, quizChannel string, quizname string, win
 	// Set delay before closing round
 	waitTime := time.Duration(waitTimeGiven) * time.Millisecond
 
-	quiz := LoadQuiz(quizname)
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find quiz: "+quizname)
+	quiz, err := LoadQuiz(quizname)
+	if err != nil {
+		reportLoadError(s, quizChannel, err)
 		stopQuiz(s, quizChannel)
 		return
 	}
+	arrangeDeck(quizname, &quiz, opts)
 
 	// Parse provided winLimit with sane defaults
 	if i, err := strconv.Atoi(winLimitGiven); err == nil {
@@ -387,6 +391,7 @@ func runMultiQuiz(s *discordgo.Session, quizChannel string, quizname string, win
 	var questionTitle string
 	players := make(map[string]int)
 	var timeoutCount int
+	render := quizRenderOptions(quiz, opts)
 
 outer:
 	for len(quiz.Deck) > 0 {
@@ -394,7 +399,7 @@ outer:
 
 		// Grab new word from the quiz
 		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
+		current, quiz.Deck = quiz.Deck[0], quiz.Deck[1:]
 		answerMap := make(map[string]time.Time)
 
 		// Populate answer map with lowercase/hiragana-reading version
@@ -405,7 +410,7 @@ outer:
 		answersLeft := len(answerMap)
 
 		// Add word to quiz history
-		if (quiz.Type == "text" || quiz.Type == "url") && len(current.Answers) > 0 {
+		if cardType := quiz.CardType(current); (cardType == "text" || cardType == "url" || cardType == "image") && len(current.Answers) > 0 {
 			quizHistory = append(quizHistory, current.Answers[0])
 			questionTitle = ""
 		} else {
@@ -422,18 +427,13 @@ outer:
 			<-c
 		}
 
-		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
+		// Send out quiz question, with more time for more answers
+		bonusTime := minint(len(current.Answers)*2, 12)
+		render.Countdown = time.Duration(timeout+bonusTime) * time.Second
+		sendQuestion(s, quizChannel, quiz, current, render)
 
 		// Set timeout for no correct answers
-		bonusTime := minint(len(current.Answers)*2, 12)
-		timeoutChan := time.NewTimer(time.Duration(timeout+bonusTime) * time.Second)
+		timeoutChan := time.NewTimer(render.Countdown)
 
 	inner:
 		for {
@@ -453,14 +453,8 @@ outer:
 					Color:       0xAA2222,
 				}
 
-				if len(current.Comment) > 0 {
-					embed.Fields = []*discordgo.MessageEmbedField{
-						&discordgo.MessageEmbedField{
-							Name:   "Comment",
-							Value:  truncate(current.Comment, 1024),
-							Inline: false,
-						}}
-				}
+				// Add comment and card details
+				embed.Fields = append(embed.Fields, cardFields(current)...)
 
 				embedSend(s, quizChannel, embed)
 
@@ -501,6 +495,11 @@ outer:
 			}
 		}
 
+		// Record round outcome for difficulty ordering
+		if quizname != "review" {
+			recordStat(quizname, current.Question, len(scoreKeeper) == 0)
+		}
+
 		if len(scoreKeeper) > 0 {
 
 			winnerExists := false
@@ -535,13 +534,8 @@ outer:
 					}},
 			}
 
-			if len(current.Comment) > 0 {
-				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-					Name:   "Comment",
-					Value:  truncate(current.Comment, 1024),
-					Inline: false,
-				})
-			}
+			// Add comment and card details
+			embed.Fields = append(embed.Fields, cardFields(current)...)
 
 			embedSend(s, quizChannel, embed)
 
@@ -555,6 +549,9 @@ outer:
 	// Clean up
 	killHandler()
 
+	// Save recorded card statistics
+	writeStats()
+
 	// Produce scoreboard
 	fields := make([]*discordgo.MessageEmbedField, 0, 2)
 	var winners string
@@ -603,7 +600,7 @@ outer:
 }
 
 // Run private gauntlet quiz
-func runGauntlet(s *discordgo.Session, m *discordgo.MessageCreate, quizname string) {
+func runGauntlet(s *discordgo.Session, m *discordgo.MessageCreate, quizname string, opts map[string]string) {
 
 	quizChannel := m.ChannelID
 
@@ -641,12 +638,13 @@ func runGauntlet(s *discordgo.Session, m *discordgo.MessageCreate, quizname stri
 
 	timeout := 120 // seconds to run complete gauntlet
 
-	quiz := LoadQuiz(quizname)
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find quiz: "+quizname)
+	quiz, err := LoadQuiz(quizname)
+	if err != nil {
+		reportLoadError(s, quizChannel, err)
 		stopQuiz(s, quizChannel)
 		return
 	}
+	arrangeDeck(quizname, &quiz, opts)
 
 	c := make(chan *discordgo.MessageCreate, 100)
 	quitChan := make(chan struct{}, 100)
@@ -676,6 +674,7 @@ func runGauntlet(s *discordgo.Session, m *discordgo.MessageCreate, quizname stri
 
 	var correct, total int
 	var quizHistory []string
+	render := quizRenderOptions(quiz, opts)
 
 	// Breathing room to read start info
 	time.Sleep(5 * time.Second)
@@ -688,7 +687,7 @@ outer:
 
 		// Grab new word from the quiz
 		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
+		current, quiz.Deck = quiz.Deck[0], quiz.Deck[1:]
 
 		// Replace readings with hiragana-only version
 		answers := make([]string, len(current.Answers))
@@ -697,13 +696,7 @@ outer:
 		}
 
 		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
+		sendQuestion(s, quizChannel, quiz, current, render)
 
 		select {
 		case <-quitChan:
@@ -715,11 +708,13 @@ outer:
 			total++
 
 			// Increase score if correct answer
-			if hasString(answers, k2h(msg.Content)) {
+			missed := !hasString(answers, k2h(msg.Content))
+			recordStat(quizname, current.Question, missed)
+			if !missed {
 				correct++
 			} else {
 				// Add wrong answer to quiz history
-				if quiz.Type == "text" && len(current.Answers) > 0 {
+				if cardType := quiz.CardType(current); (cardType == "text" || cardType == "url" || cardType == "image") && len(current.Answers) > 0 {
 					quizHistory = append(quizHistory, current.Answers[0])
 				} else {
 					quizHistory = append(quizHistory, current.Question)
@@ -731,6 +726,9 @@ outer:
 	// Clean up
 	killHandler()
 
+	// Save recorded card statistics
+	writeStats()
+
 	// Sleep for a little breathing room
 	time.Sleep(1 * time.Second)
 
@@ -1020,3 +1018,99 @@ outer:
 
 	stopQuiz(s, quizChannel)
 }
+
+// Returns the options question images of a quiz get rendered with, command options going before deck settings
+func quizRenderOptions(quiz Quiz, opts map[string]string) RenderOptions {
+
+	render := RenderOptions{Distort: quiz.Distort, Font: quiz.Font, Vertical: quiz.Vertical, Ruby: quiz.Ruby}
+	if opt, ok := opts["distort"]; ok {
+		render.Distort = isEnabled(opt)
+	}
+	if opt, ok := opts["vertical"]; ok {
+		render.Vertical = isEnabled(opt)
+	}
+	if opt, ok := opts["font"]; ok {
+		render.Font = opt
+	}
+
+	// Hints come as animations revealing the question, the countdown alone with animate=on
+	render.Reveal = isEnabled(opts["hint"])
+	render.Animate = render.Reveal || isEnabled(opts["animate"])
+
+	return render
+}
+
+// Send out card question in the form of its type
+func sendQuestion(s *discordgo.Session, quizChannel string, quiz Quiz, card Card, render RenderOptions) {
+
+	// Accompanying picture goes first
+	if len(card.Image) > 0 {
+		if isURL(card.Image) {
+			msgSend(s, quizChannel, card.Image)
+		} else {
+			assetSend(s, quizChannel, card.Image, quiz.ImageSize, quiz.ImageCrop)
+		}
+	}
+
+	switch quiz.CardType(card) {
+	case "text":
+		msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", card.Question))
+	case "url":
+		msgSend(s, quizChannel, card.Question)
+	case "image":
+		assetSend(s, quizChannel, card.Question, quiz.ImageSize, quiz.ImageCrop)
+	default:
+		if len(card.Context) > 0 {
+			render.Highlight = card.Question
+			imgOptionsSend(s, quizChannel, card.Context, render)
+		} else {
+			imgOptionsSend(s, quizChannel, card.Question, render)
+		}
+	}
+}
+
+// Build embed fields for card comment and optional metadata
+func cardFields(card Card) (fields []*discordgo.MessageEmbedField) {
+
+	if len(card.Furigana) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Furigana",
+			Value:  truncate(card.Furigana, DISCORD_FIELD_MAX),
+			Inline: false,
+		})
+	}
+
+	if len(card.Comment) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Comment",
+			Value:  truncate(card.Comment, DISCORD_FIELD_MAX),
+			Inline: false,
+		})
+	}
+
+	if card.Difficulty > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Difficulty",
+			Value:  strings.Repeat("★", card.Difficulty) + strings.Repeat("☆", maxint(CARD_DIFFICULTY_MAX-card.Difficulty, 0)),
+			Inline: true,
+		})
+	}
+
+	if len(card.Tags) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Tags",
+			Value:  truncate(strings.Join(card.Tags, ", "), DISCORD_FIELD_MAX),
+			Inline: true,
+		})
+	}
+
+	if len(card.Source) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Source",
+			Value:  truncate(card.Source, DISCORD_FIELD_MAX),
+			Inline: true,
+		})
+	}
+
+	return
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"sync"
+)
+
+// Filename for recorded card statistics
+const STATS_FILE = "stats.json"
+
+// Per-card answer statistics
+type CardStat struct {
+	Seen   int `json:"seen"`
+	Missed int `json:"missed"`
+}
+
+// Recorded card statistics, keyed by quiz name and then card question
+var Stats struct {
+	sync.RWMutex
+	Map map[string]map[string]CardStat
+}
+
+// Smoothed miss rate, so unseen cards land in the middle of the pack
+func (cs CardStat) MissRate() float64 {
+	return float64(cs.Missed+1) / float64(cs.Seen+2)
+}
+
+// Record the outcome of a single quiz round in memory
+func recordStat(quizname string, question string, missed bool) {
+	Stats.Lock()
+	deck, ok := Stats.Map[quizname]
+	if !ok {
+		deck = make(map[string]CardStat)
+		Stats.Map[quizname] = deck
+	}
+
+	stat := deck[question]
+	stat.Seen++
+	if missed {
+		stat.Missed++
+	}
+	deck[question] = stat
+	Stats.Unlock()
+}
+
+// Returns recorded statistics for given card
+func getStat(quizname string, question string) CardStat {
+	Stats.RLock()
+	stat := Stats.Map[quizname][question]
+	Stats.RUnlock()
+
+	return stat
+}
+
+// Writes Stats map as JSON to disk
+func writeStats() {
+	Stats.RLock()
+	b, err := json.Marshal(Stats.Map)
+	Stats.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Stats to json: ", err)
+	} else if err = ioutil.WriteFile(STATS_FILE, b, 0644); err != nil {
+		log.Println("ERROR, Could not write Stats file to disk: ", err)
+	}
+}
+
+// Load Stats map from JSON on disk
+func loadStats() {
+
+	Stats.Lock()
+	defer Stats.Unlock()
+
+	Stats.Map = make(map[string]map[string]CardStat)
+
+	file, err := ioutil.ReadFile(STATS_FILE)
+	if err != nil {
+		log.Println("ERROR, Reading Stats json: ", err)
+		return
+	}
+
+	err = json.Unmarshal(file, &Stats.Map)
+	if err != nil {
+		log.Println("ERROR, Unmarshalling Stats json: ", err)
+	}
+
+	if Stats.Map == nil {
+		Stats.Map = make(map[string]map[string]CardStat)
+	}
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
-	"log"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -75,15 +77,145 @@ func (set SortedStringSet) Values() []string {
 	return keys
 }
 
-// ValidateQuizzes will run through the following checks:
-//   checkDuplicates - validates duplicate questions and answers
+// Severity of a validation issue
+type Severity int
+
+const (
+	SEVERITY_NOTICE  Severity = iota // Worth a look when tidying up a deck, only listed on request
+	SEVERITY_WARNING                 // Suspicious, but the quiz still plays fine
+	SEVERITY_ERROR                   // Broken cards or settings that need fixing
+)
+
+func (sv Severity) String() string {
+	switch sv {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_NOTICE:
+		return "notice"
+	}
+	return "warning"
+}
+
+// Severities are reported by name in JSON
+func (sv Severity) MarshalText() ([]byte, error) {
+	return []byte(sv.String()), nil
+}
+
+// Issue is a single problem found in a quiz, with the question of the card involved if any
+type Issue struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Question string   `json:"question,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	if len(i.Question) > 0 {
+		return fmt.Sprintf("%s [%s] %s: %s", i.Severity, i.Check, i.Question, i.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s", i.Severity, i.Check, i.Message)
+}
+
+// Validator checks a quiz for one kind of problem
+type Validator interface {
+	Name() string
+	Check(quiz Quiz) []Issue
+}
+
+// Fixer is implemented by validators that can repair the problems they find
+// Fix returns a fixed copy and leaves the given quiz untouched
+type Fixer interface {
+	Fix(quiz Quiz) Quiz
+}
+
+// Validators run on every quiz, in registration order
+var Validators []Validator
+
+// Add a validator to the checks run on every quiz
+func registerValidator(v Validator) {
+	Validators = append(Validators, v)
+}
+
+// Create an issue with a formatted message
+func newIssue(v Validator, severity Severity, question string, format string, args ...interface{}) Issue {
+	return Issue{
+		Check:    v.Name(),
+		Severity: severity,
+		Question: question,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Run all registered validators on a quiz, except those the quiz opts out of
+// Every validator sees the quiz as given, while fixes for the issues found are applied one after another
+func validateQuiz(quiz Quiz) (issues []Issue, fixed Quiz) {
+
+	fixed = quiz
+	for _, v := range Validators {
+		if hasString(quiz.SkipChecks, v.Name()) {
+			continue
+		}
+		found := v.Check(quiz)
+		if len(found) == 0 {
+			continue
+		}
+		issues = append(issues, found...)
+
+		if f, ok := v.(Fixer); ok {
+			fixed = f.Fix(fixed)
+		}
+	}
+
+	return issues, fixed
+}
+
+// Returns true if any of the issues can be fixed automatically
+func hasFixes(issues []Issue) bool {
+	for _, v := range Validators {
+		if _, ok := v.(Fixer); !ok {
+			continue
+		}
+		for _, issue := range issues {
+			if issue.Check == v.Name() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Validation results of a single quiz
+type QuizReport struct {
+	Quiz    string  `json:"quiz"`
+	Error   string  `json:"error,omitempty"` // Set if the quiz could not be loaded
+	Issues  []Issue `json:"issues"`
+	Fixed   string  `json:"fixed,omitempty"`   // Path of the generated fixed copy
+	Skipped string  `json:"skipped,omitempty"` // Why no fixed copy was generated despite fixable issues
+}
+
+// Returns true if the quiz failed to load or has issues of error severity
+func (r QuizReport) Failed() bool {
+	if len(r.Error) > 0 {
+		return true
+	}
+	for _, issue := range r.Issues {
+		if issue.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateQuizzes runs every registered Validator on the given quizzes and returns their reports sorted by name
 //
 // Parameter quizNames defines the quizzes to be checked
-// Parameter generateFix is a boolean that controls the creation of fixed quiz copies
-func ValidateQuizzes(quizNames []string, generateFix bool) {
+// Parameter generateFix is a boolean that controls the creation of fixed quiz copies next to the quiz files
+func ValidateQuizzes(quizNames []string, generateFix bool) []QuizReport {
 
 	quizzes := make(chan string, len(quizNames))
-	done := make(chan string, len(quizNames))
+	done := make(chan QuizReport, len(quizNames))
 
 	for w := 0; w < runtime.NumCPU(); w++ {
 		go quizValidationWorker(quizzes, done, generateFix)
@@ -94,126 +226,188 @@ func ValidateQuizzes(quizNames []string, generateFix bool) {
 	}
 	close(quizzes)
 
-	for w := 0; w < len(quizNames); w++ {
-		q := <-done
-		log.Printf("[%s] Validation complete\n", q)
+	reports := make([]QuizReport, len(quizNames))
+	for i := range reports {
+		reports[i] = <-done
 	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Quiz < reports[j].Quiz })
+
+	return reports
 }
 
-func quizValidationWorker(quizzes <-chan string, done chan<- string, generateFix bool) {
+func quizValidationWorker(quizzes <-chan string, done chan<- QuizReport, generateFix bool) {
 	for quizName := range quizzes {
-		quiz := LoadQuiz(quizName)
-		log.Printf("[%s] Running checks...\n", quizName)
-
-		// Run checks
-		//
-		// *TODO* look into making a validator interface and move specific validation logic into structs when the list
-		//        of validations grows too long, or if some have particularly complex logic
-		fixed, hasError := checkDuplicates(quiz)
-
-		if hasError && generateFix {
-
-			// Create a copy of quiz file
-			// Delete if exists
-			fileName := QUIZ_FOLDER + Quizzes.Map[quizName] + ".fix"
-			if _, err := os.Stat(fileName); !os.IsNotExist(err) {
-				err := os.Remove(fileName)
-				if err != nil {
-					log.Fatal(err)
-				}
+		report := QuizReport{Quiz: quizName, Issues: []Issue{}}
+
+		quiz, err := LoadQuiz(quizName)
+		if err != nil {
+			report.Error = err.Error()
+			done <- report
+			continue
+		}
+
+		issues, fixed := validateQuiz(quiz)
+		report.Issues = append(report.Issues, issues...)
+
+		// Composed quizzes get fixed through the quizzes they include
+		if generateFix && hasFixes(issues) && len(quiz.Included) > 0 {
+			report.Skipped = fmt.Sprintf("Composed from %s, fix those instead", strings.Join(quiz.Included, ", "))
+		} else if generateFix && hasFixes(issues) {
+			info, _ := GetQuizInfo(quizName)
+			fileName := QUIZ_FOLDER + info.File + ".fix"
+
+			// Keep the format of the original file
+			var buf bytes.Buffer
+			err := encodeQuiz(info.File, &buf, fixed)
+			if err == nil {
+				err = ioutil.WriteFile(fileName, buf.Bytes(), 0644)
 			}
-			f, err := os.Create(fileName)
 			if err != nil {
-				log.Fatal(err)
+				report.Error = fmt.Sprintf("Could not write fixed file: %s", err)
+			} else {
+				report.Fixed = fileName
 			}
-			w := bufio.NewWriter(f)
-
-			// Write quiz JSON file
-			buf := new(bytes.Buffer)
-			enc := json.NewEncoder(buf)
-			enc.SetEscapeHTML(false)
-			if err := enc.Encode(&fixed); err != nil {
-				log.Fatal(err)
+		}
+
+		done <- report
+	}
+}
+
+// Validate quizzes offline, printing a summary or JSON report and failing on errors
+func validateCommand(args []string) int {
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "write fixed copies of quiz files as <file>.fix")
+	jsonReport := fs.Bool("json", false, "print the report as JSON, with the summary on stderr")
+	warnings := warningFilter{Warnings: true}
+	fs.Var(&warnings, "warnings", "list warnings in the summary, or also the notices of the given comma separated checks, like readings")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s validate [options] [deck...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := loadQuizList(); err != nil {
+		return 1
+	}
+
+	// Reading checks need kanji info, but can do without
+	if _, err := os.Stat(RESOURCES_FOLDER + "all-kanji.json"); err == nil {
+		loadAllKanji()
+	}
+
+	// Same for glyph checks and fonts
+	if _, err := os.Stat(RESOURCES_FOLDER + fontFile); err == nil {
+		loadFont()
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = GetQuizlist()
+	}
+	reports := ValidateQuizzes(names, *fix)
+	for i := range reports {
+		reports[i].Issues = warnings.Filter(reports[i].Issues)
+	}
+
+	summary := os.Stdout
+	if *jsonReport {
+		summary = os.Stderr
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(reports); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR, Encoding report:", err)
+			return 1
+		}
+	}
+
+	status := 0
+	var errorCount, warningCount, noticeCount int
+	for _, report := range reports {
+		if report.Failed() {
+			status = 1
+		}
+
+		if len(report.Error) > 0 {
+			errorCount++
+			fmt.Fprintf(summary, "[%s] %s\n", report.Quiz, report.Error)
+		}
+		for _, issue := range report.Issues {
+			switch issue.Severity {
+			case SEVERITY_ERROR:
+				errorCount++
+			case SEVERITY_NOTICE:
+				noticeCount++
+			default:
+				warningCount++
+				if !warnings.Warnings {
+					continue
+				}
 			}
+			fmt.Fprintf(summary, "[%s] %s\n", report.Quiz, issue)
+		}
+		if len(report.Fixed) > 0 {
+			fmt.Fprintf(summary, "[%s] Wrote fixed file %s\n", report.Quiz, report.Fixed)
+		}
+		if len(report.Skipped) > 0 {
+			fmt.Fprintf(summary, "[%s] Skipped fixed file: %s\n", report.Quiz, report.Skipped)
+		}
+	}
+	if len(warnings.Notices) > 0 {
+		fmt.Fprintf(summary, "Checked %d quizzes: %d errors, %d warnings, %d notices\n", len(reports), errorCount, warningCount, noticeCount)
+	} else {
+		fmt.Fprintf(summary, "Checked %d quizzes: %d errors, %d warnings\n", len(reports), errorCount, warningCount)
+	}
 
-			// Indent the JSON manually
-			j := strings.NewReplacer(
-				`"description":`, "\n\t"+`"description": `,
-				`"type":`, "\n\t"+`"type": `,
-				`"timeout":`, "\n\t"+`"timeout": `,
-				`"deck":[`, "\n\t"+`"deck": [`,
-				`{"question":`, "\n\t\t"+`{ "question": `,
-				`,"answers":[`, `, "answers": [ `,
-				`],"comment":`, ` ], "comment": `,
-				`}]}`, `}`+"\n\t]\n"+`}`+"\n",
-			).Replace(buf.String())
-			strings.NewReplacer(
-				`]}`, `] }`,
-				`"}`, `" }`,
-				`"]`, `" ]`,
-			).WriteString(w, j)
-			w.Flush()
-			f.Close()
-			log.Printf("[%s] Generated fixed file %s\n", quizName, fileName)
-		}
-
-		done <- quizName
-	}
-}
-
-// Checks duplicate questions and answers in a given quiz
-// Currently the strategy is to merge the answers and comments for cards with the same question
-// Returns fixed quiz
-func checkDuplicates(quiz Quiz) (Quiz, bool) {
-	log.Println("Checking duplicates...")
-	var hasError bool
-
-	// Use a map to hold merged card data temporarily
-	cardMap := make(map[string][]*SortedStringSet)
-	for _, card := range quiz.Deck {
-		question := card.Question
-
-		var cardDataSets []*SortedStringSet
-		if cardMap[question] != nil {
-			cardDataSets = cardMap[question]
-			log.Printf("\tFound duplicate question: %s", question)
-			hasError = true
-		} else {
-			cardDataSets = []*SortedStringSet{NewStringSet(), NewStringSet()}
-		}
-		cardDataSets[1].Add(card.Comment)
-
-		dups := cardDataSets[0].AddAll(card.Answers...)
-		if dups != nil {
-			hasError = true
-			log.Printf("\tFound duplicate answers: %s\n", strings.Join(dups, ", "))
-		}
-		cardMap[question] = cardDataSets
-	}
-
-	// Populate quiz deck with fixed cards
-	fixedDeck := make([]Card, len(cardMap))
-	i := 0
-	for question, cardDataSets := range cardMap {
-		fixedDeck[i] = Card{
-			Question: question,
-			Answers:  cardDataSets[0].Values(),
-			Comment:  strings.Join(cardDataSets[1].Values(), "\n")}
-		i++
+	return status
+}
+
+// Flag value of the validate command saying which issues get listed besides errors
+// Takes true or false for warnings, or names of checks whose notices get listed along with warnings
+type warningFilter struct {
+	Warnings bool
+	Notices  []string
+}
+
+func (wf *warningFilter) String() string {
+	if len(wf.Notices) > 0 {
+		return strings.Join(wf.Notices, ",")
 	}
-	sort.Slice(fixedDeck, func(i, j int) bool {
+	return strconv.FormatBool(wf.Warnings)
+}
 
-		// Since we're deduping, the questions should never be equal
-		if fixedDeck[i].Question < fixedDeck[j].Question {
-			return true
+func (wf *warningFilter) Set(value string) error {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		wf.Warnings, wf.Notices = enabled, nil
+		return nil
+	}
+
+	wf.Warnings, wf.Notices = true, nil
+	for _, name := range strings.Split(value, ",") {
+		known := false
+		for _, v := range Validators {
+			known = known || v.Name() == name
 		}
-		return false
-	})
+		if !known {
+			return fmt.Errorf("unknown check '%s'", name)
+		}
+		wf.Notices = append(wf.Notices, name)
+	}
+
+	return nil
+}
+
+// Returns the issues without notices of checks not asked for
+func (wf *warningFilter) Filter(issues []Issue) []Issue {
+	filtered := issues[:0]
+	for _, issue := range issues {
+		if issue.Severity != SEVERITY_NOTICE || hasString(wf.Notices, issue.Check) {
+			filtered = append(filtered, issue)
+		}
+	}
 
-	return Quiz{
-		Description: quiz.Description,
-		Type:        quiz.Type,
-		Timeout:     quiz.Timeout,
-		Deck:        fixedDeck,
-	}, hasError
+	return filtered
 }
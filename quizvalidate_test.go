@@ -2,8 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"image"
+	"image/png"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -58,8 +63,8 @@ func TestValidations(t *testing.T) {
 	// Weird to initialize a global in a test like this
 	// Would be better to eventually have another less specific test covering the bot's initialization
 	loadQuizList()
-	Quizzes.Map[TestQuiz] = "_" + TestQuiz + ".json"
-	fixedQuizPath := QUIZ_FOLDER + Quizzes.Map[TestQuiz] + ".fix"
+	Quizzes.Map[TestQuiz] = QuizInfo{File: "_" + TestQuiz + ".json"}
+	fixedQuizPath := QUIZ_FOLDER + Quizzes.Map[TestQuiz].File + ".fix"
 
 	// Raw strings and indentation don't go together
 	correctQuizRaw := `{
@@ -74,7 +79,11 @@ func TestValidations(t *testing.T) {
 
 	// Actual validation logic is tested below
 	// This test covers the genereation of fixed quiz copies
-	ValidateQuizzes(GetQuizlist(), true)
+	for _, report := range ValidateQuizzes(GetQuizlist(), true) {
+		if report.Quiz == TestQuiz && (!report.Failed() || report.Fixed != fixedQuizPath) {
+			t.Errorf("Validation report mismatch: %+v", report)
+		}
+	}
 	var fixedQuiz Quiz
 	f, err := os.Open(fixedQuizPath)
 	if err != nil {
@@ -112,7 +121,10 @@ func TestDuplicateValidation(t *testing.T) {
 	f.Close()
 
 	dedupQuiz := createTestQuiz(dedupQuizRaw)
-	fixedQuiz, _ := checkDuplicates(dupQuiz)
+	if len(duplicateValidator{}.Check(dupQuiz)) == 0 {
+		t.Error("Check duplicates should report duplicates")
+	}
+	fixedQuiz := duplicateValidator{}.Fix(dupQuiz)
 
 	// Ignoring comment field because supporting field-specific comparison behavior is too annoying
 	if !quizEqual(dedupQuiz, fixedQuiz, cmpopts.IgnoreFields(Card{}, "Comment")) {
@@ -138,3 +150,158 @@ func quizEqual(qx, qy Quiz, additionalOpts ...cmp.Option) bool {
 	opts = append(opts, additionalOpts...)
 	return cmp.Equal(qx, qy, opts...)
 }
+
+func TestMetadataValidation(t *testing.T) {
+
+	quiz := createTestQuiz(`{
+	"description": "Test quiz with metadata",
+	"deck": [
+		{ "question": "q1", "answers": [ "a" ], "difficulty": 3, "weight": 2.5, "tags": [ "noun" ] },
+		{ "question": "q2", "answers": [ "b" ], "difficulty": 9, "weight": -1, "tags": [ "verb", " " ] }
+	]
+}`)
+
+	correctQuiz := createTestQuiz(`{
+	"description": "Test quiz with metadata",
+	"deck": [
+		{ "question": "q1", "answers": [ "a" ], "difficulty": 3, "weight": 2.5, "tags": [ "noun" ] },
+		{ "question": "q2", "answers": [ "b" ], "tags": [ "verb" ] }
+	]
+}`)
+
+	if len(metadataValidator{}.Check(quiz)) != 3 {
+		t.Error("Check metadata should report out of range values")
+	}
+	if fixedQuiz := (metadataValidator{}).Fix(quiz); !quizEqual(correctQuiz, fixedQuiz) {
+		t.Errorf("Check metadata failed! %+v != %+v", correctQuiz, fixedQuiz)
+	}
+
+	if len(metadataValidator{}.Check(correctQuiz)) > 0 {
+		t.Error("Check metadata should accept valid values")
+	}
+}
+
+func TestImageAssetValidation(t *testing.T) {
+
+	// Write out a tiny image asset to check against, leaving no trace in the quizzes folder
+	assetPath := "assets/_quizvalidate_test.png"
+	if _, err := os.Stat(QUIZ_ASSETS_FOLDER); os.IsNotExist(err) {
+		if err := os.Mkdir(QUIZ_ASSETS_FOLDER, 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(QUIZ_ASSETS_FOLDER) })
+	}
+	f, err := os.Create(QUIZ_FOLDER + assetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(QUIZ_FOLDER + assetPath) })
+	err = png.Encode(f, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validQuiz := Quiz{Type: "image", Deck: []Card{{Question: assetPath, Answers: []string{"a"}}}}
+	if len(imageAssetValidator{}.Check(validQuiz)) > 0 {
+		t.Error("Check image assets should accept existing image")
+	}
+
+	missingQuiz := Quiz{Deck: []Card{{Question: "q1", Answers: []string{"a"}, Image: "assets/_missing.png"}}}
+	if len(imageAssetValidator{}.Check(missingQuiz)) == 0 {
+		t.Error("Check image assets should report missing image")
+	}
+
+	// Paths leading out of the assets folder are refused before touching any file
+	outsideQuiz := Quiz{Type: "image", Deck: []Card{
+		{Question: "assets/../tokyo.json", Answers: []string{"a"}},
+		{Question: "/etc/passwd", Answers: []string{"b"}},
+		{Question: "../resources/avatar.png", Answers: []string{"c"}},
+	}}
+	for _, issue := range (imageAssetValidator{}).Check(outsideQuiz) {
+		if issue.Severity != SEVERITY_ERROR || !strings.Contains(issue.Message, "outside of") {
+			t.Errorf("Image path outside of assets should be an error: %+v", issue)
+		}
+	}
+	if questions := issueQuestions(imageAssetValidator{}, outsideQuiz); len(questions) != 3 {
+		t.Errorf("Check image assets reported outside paths %v", questions)
+	}
+	if _, _, err := loadImageAsset("assets/../../resources/avatar.png", 0, false); err == nil {
+		t.Error("Loading an image outside of assets should fail")
+	}
+
+	remoteQuiz := Quiz{Type: "url", Deck: []Card{
+		{Question: "https://example.com/q1.png", Answers: []string{"a"}},
+		{Question: "q2", Answers: []string{"b"}, Image: "https://example.com/q2.png"},
+		{Question: "q3", Answers: []string{"c"}, Type: "text"},
+	}}
+	issues := imageAssetValidator{}.Check(remoteQuiz)
+	if questions := issueQuestions(imageAssetValidator{}, remoteQuiz); !cmp.Equal(questions, []string{"https://example.com/q1.png", "q2"}) {
+		t.Errorf("Check image assets reported remote images %v", questions)
+	}
+	for _, issue := range issues {
+		if issue.Severity != SEVERITY_WARNING {
+			t.Errorf("Remote image should be a warning: %+v", issue)
+		}
+	}
+}
+
+func TestFetchImageAssets(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snake.png" {
+			http.NotFound(w, r)
+			return
+		}
+		png.Encode(w, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	}))
+	defer server.Close()
+	defer os.RemoveAll(QUIZ_ASSETS_FOLDER + "_fetch_test")
+
+	quiz := Quiz{Type: "url", Deck: []Card{
+		{Question: server.URL + "/snake.png", Answers: []string{"蛇"}},
+		{Question: "q2", Answers: []string{"b"}, Type: "text", Image: server.URL + "/snake.png"},
+	}}
+	fetched, count, errs := fetchImageAssets(quiz, "_fetch_test")
+	expected := Quiz{Type: "image", Deck: []Card{
+		{Question: "assets/_fetch_test/snake.png", Answers: []string{"蛇"}},
+		{Question: "q2", Answers: []string{"b"}, Type: "text", Image: "assets/_fetch_test/snake.png"},
+	}}
+	if count != 2 || len(errs) > 0 || !quizEqual(fetched, expected) {
+		t.Errorf("Fetch image assets returned %d %v %+v", count, errs, fetched)
+	}
+	if err := checkImageAsset("assets/_fetch_test/snake.png"); err != nil {
+		t.Error(err)
+	}
+
+	// Failed downloads keep their links and the deck type
+	quiz.Deck[0].Question = server.URL + "/missing.png"
+	fetched, count, errs = fetchImageAssets(quiz, "_fetch_test")
+	if count != 1 || len(errs) != 1 || fetched.Type != "url" || fetched.Deck[0].Question != quiz.Deck[0].Question {
+		t.Errorf("Fetch image assets with a missing image returned %d %v %+v", count, errs, fetched)
+	}
+}
+
+func TestWarningFilter(t *testing.T) {
+
+	issues := []Issue{
+		{Severity: SEVERITY_ERROR, Check: "empty"},
+		{Severity: SEVERITY_NOTICE, Check: "readings"},
+		{Severity: SEVERITY_WARNING, Check: "readings"},
+		{Severity: SEVERITY_NOTICE, Check: "duplicates"},
+	}
+
+	var wf warningFilter
+	if err := wf.Set("readings"); err != nil || !wf.Warnings {
+		t.Errorf("Set readings notices failed: %v %+v", err, wf)
+	}
+	if filtered := wf.Filter(append([]Issue{}, issues...)); !cmp.Equal(filtered, issues[:3]) {
+		t.Errorf("Filter readings notices returned %+v", filtered)
+	}
+	if err := wf.Set("false"); err != nil || wf.Warnings || len(wf.Notices) != 0 {
+		t.Errorf("Set false failed: %v %+v", err, wf)
+	}
+	if err := wf.Set("readings,nonsense"); err == nil {
+		t.Errorf("Set accepted an unknown check: %+v", wf)
+	}
+}
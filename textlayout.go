@@ -0,0 +1,357 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Line height and first baseline relative to the font size in pixels
+const (
+	LINE_SPACING    = 1.18
+	BASELINE_OFFSET = 0.94
+)
+
+// Baseline within the square cell of an upright glyph in vertical text
+const VERTICAL_BASELINE = 0.88
+
+// Size of ruby text relative to its base text
+const RUBY_SCALE = 0.5
+
+// Characters turned a quarter clockwise in vertical text, besides half width ones
+const VERTICAL_TURNED = "ー－〜～…‥―‐—（）「」『』【】〈〉《》〔〕［］｛｝＜＞＝→←"
+
+// Punctuation moved from the bottom left to the top right of its cell in vertical text
+const VERTICAL_PUNCTUATION = "、。，．"
+
+// Small kana nudged towards the top right of their cell in vertical text
+const VERTICAL_SMALL_KANA = "ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ"
+
+// A run of base text with the ruby drawn alongside it, if any
+type rubyGroup struct {
+	Base string
+	Ruby string
+}
+
+// A glyph placed on the canvas
+type placedGlyph struct {
+	Rune      rune
+	Dot       fixed.Point26_6 // Pen position the glyph is drawn at
+	Ruby      bool            // Drawn with the smaller ruby face
+	Highlight bool            // Drawn in highlight colour
+	Turned    bool            // Turned a quarter clockwise around its centre
+}
+
+// Glyph positions and canvas size of laid out text
+type textLayout struct {
+	Glyphs    []placedGlyph
+	Width     int
+	Height    int
+	Baselines []int // Heights strike lines get drawn around
+}
+
+// Split a line with ruby markup like 漢字《かんじ》 or ｜東京《とうきょう》 into groups
+// Without ｜ the ruby goes with the kanji right before it
+func parseRuby(line string) []rubyGroup {
+
+	var groups []rubyGroup
+	var plain []rune
+	explicit := -1 // Start of a base marked with ｜ within plain
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '｜' && strings.ContainsRune(string(runes[i+1:]), '《'):
+			explicit = len(plain)
+		case r == '《':
+			end := strings.IndexRune(string(runes[i+1:]), '》')
+			start := explicit
+			if start < 0 {
+				start = len(plain)
+				for start > 0 && isRubyBase(plain[start-1]) {
+					start--
+				}
+			}
+			if end < 0 || start == len(plain) {
+				// Nothing to attach to, so not ruby
+				plain = append(plain, r)
+				continue
+			}
+			ruby := []rune(string(runes[i+1:])[:end])
+
+			if start > 0 {
+				groups = append(groups, rubyGroup{Base: string(plain[:start])})
+			}
+			groups = append(groups, rubyGroup{Base: string(plain[start:]), Ruby: string(ruby)})
+			plain, explicit = nil, -1
+			i += len(ruby) + 1
+		default:
+			plain = append(plain, r)
+		}
+	}
+	if len(plain) > 0 || len(groups) == 0 {
+		groups = append(groups, rubyGroup{Base: string(plain)})
+	}
+
+	return groups
+}
+
+// Returns true for characters ruby without ｜ attaches to
+func isRubyBase(r rune) bool {
+	return unicode.Is(unicode.Han, r) || r == '々' || r == '〆' || r == 'ヶ'
+}
+
+// Returns the text of a line without ruby markup
+func rubyBase(groups []rubyGroup) string {
+	var base string
+	for _, group := range groups {
+		base += group.Base
+	}
+
+	return base
+}
+
+// Returns which runes of the text are part of an occurrence of highlight
+func highlightMask(text []rune, highlight string) []bool {
+
+	mask := make([]bool, len(text))
+	target := []rune(highlight)
+	if len(target) == 0 {
+		return mask
+	}
+
+	for i := 0; i+len(target) <= len(text); i++ {
+		if string(text[i:i+len(target)]) == highlight {
+			for j := range target {
+				mask[i+j] = true
+			}
+			i += len(target) - 1
+		}
+	}
+
+	return mask
+}
+
+// Lay out lines of text with ruby groups in a font size, left to right and top to bottom
+func layoutHorizontal(lines [][]rubyGroup, highlight string, size float64, base font.Face, ruby font.Face) textLayout {
+
+	em := size * fontDpi / 72
+	lineHeight := int(math.Ceil(em * LINE_SPACING))
+	rubyHeight := 0
+	if hasRuby(lines) {
+		rubyHeight = int(math.Ceil(float64(lineHeight) * RUBY_SCALE))
+	}
+
+	var widest fixed.Int26_6
+	for _, groups := range lines {
+		var width fixed.Int26_6
+		for _, group := range groups {
+			w, _, _ := groupWidth(group, base, ruby)
+			width += w
+		}
+		if width > widest {
+			widest = width
+		}
+	}
+
+	layout := textLayout{
+		Width:  widest.Round() * 11 / 10, // 10% extra for margins
+		Height: len(lines) * (lineHeight + rubyHeight),
+	}
+
+	x := fixed.I(layout.Width-widest.Round()) / 2
+	y := int(math.Ceil(em*BASELINE_OFFSET)) + rubyHeight
+	for _, groups := range lines {
+		layout.Baselines = append(layout.Baselines, y)
+		mask := highlightMask([]rune(rubyBase(groups)), highlight)
+
+		dot := x
+		var index int
+		for _, group := range groups {
+			w, bw, rw := groupWidth(group, base, ruby)
+			lit := false
+
+			pen := dot + (w-bw)/2
+			prev := rune(-1)
+			for _, r := range group.Base {
+				if prev >= 0 {
+					pen += base.Kern(prev, r)
+				}
+				layout.Glyphs = append(layout.Glyphs, placedGlyph{Rune: r, Dot: fixed.Point26_6{X: pen, Y: fixed.I(y)}, Highlight: mask[index]})
+				lit = lit || mask[index]
+				advance, _ := base.GlyphAdvance(r)
+				pen += advance
+				prev = r
+				index++
+			}
+
+			// Ruby sits centred in the space above its base
+			pen = dot + (w-rw)/2
+			rubyY := y - int(math.Ceil(em*BASELINE_OFFSET)) - rubyHeight + int(math.Ceil(em*RUBY_SCALE*BASELINE_OFFSET))
+			for _, r := range group.Ruby {
+				layout.Glyphs = append(layout.Glyphs, placedGlyph{Rune: r, Dot: fixed.Point26_6{X: pen, Y: fixed.I(rubyY)}, Ruby: true, Highlight: lit})
+				advance, _ := ruby.GlyphAdvance(r)
+				pen += advance
+			}
+
+			dot += w
+		}
+
+		y += lineHeight + rubyHeight
+	}
+
+	return layout
+}
+
+// Lay out lines of text with ruby groups as columns, top to bottom and right to left
+// Ruby goes to the right of its base, and marks and punctuation get turned or moved like in books
+func layoutVertical(lines [][]rubyGroup, highlight string, size float64, base font.Face, ruby font.Face) textLayout {
+
+	em := size * fontDpi / 72
+	rubyEm := em * RUBY_SCALE
+	lineHeight := int(math.Ceil(em * LINE_SPACING))
+	rubyWidth := 0
+	if hasRuby(lines) {
+		rubyWidth = int(math.Ceil(float64(lineHeight) * RUBY_SCALE))
+	}
+	columnWidth := lineHeight + rubyWidth
+
+	var tallest float64
+	for _, groups := range lines {
+		var height float64
+		for _, group := range groups {
+			height += groupHeight(group, em, base, ruby)
+		}
+		tallest = math.Max(tallest, height)
+	}
+
+	layout := textLayout{
+		Width:  len(lines) * columnWidth,
+		Height: int(math.Ceil(tallest)) * 11 / 10, // 10% extra for margins
+	}
+	top := float64(layout.Height-int(math.Ceil(tallest))) / 2
+	for y := top + em; y <= top+tallest; y += 3 * em {
+		layout.Baselines = append(layout.Baselines, int(y))
+	}
+
+	// Place a glyph in the cell at top with its centre at x
+	place := func(face font.Face, size float64, r rune, x float64, top float64) placedGlyph {
+		h := cellHeight(face, size, r)
+		glyph := placedGlyph{Rune: r}
+
+		if isTurned(r) {
+			// Centre the glyph's bounds on the cell, so it turns in place
+			bounds, _, _ := face.GlyphBounds(r)
+			cx := float64(bounds.Min.X+bounds.Max.X) / 128
+			cy := float64(bounds.Min.Y+bounds.Max.Y) / 128
+			glyph.Dot = fixed.Point26_6{X: fixed.Int26_6((x - cx) * 64), Y: fixed.Int26_6((top + h/2 - cy) * 64)}
+			glyph.Turned = true
+			return glyph
+		}
+
+		advance, _ := face.GlyphAdvance(r)
+		dx, dy := x-float64(advance)/128, top+size*VERTICAL_BASELINE
+		switch {
+		case strings.ContainsRune(VERTICAL_PUNCTUATION, r):
+			dx, dy = dx+size*0.55, dy-size*0.55
+		case strings.ContainsRune(VERTICAL_SMALL_KANA, r):
+			dx, dy = dx+size*0.1, dy-size*0.1
+		}
+		glyph.Dot = fixed.Point26_6{X: fixed.Int26_6(dx * 64), Y: fixed.Int26_6(dy * 64)}
+
+		return glyph
+	}
+
+	for i, groups := range lines {
+		left := float64(layout.Width - (i+1)*columnWidth)
+		baseX := left + float64(lineHeight)/2
+		rubyX := left + (float64(lineHeight)+em)/2 + rubyEm/2
+		mask := highlightMask([]rune(rubyBase(groups)), highlight)
+
+		y := top
+		var index int
+		for _, group := range groups {
+			bl, rl := columnLength(base, em, group.Base), columnLength(ruby, rubyEm, group.Ruby)
+			gl := math.Max(bl, rl)
+			lit := false
+
+			cell := y + (gl-bl)/2
+			for _, r := range group.Base {
+				glyph := place(base, em, r, baseX, cell)
+				glyph.Highlight = mask[index]
+				lit = lit || mask[index]
+				layout.Glyphs = append(layout.Glyphs, glyph)
+				cell += cellHeight(base, em, r)
+				index++
+			}
+
+			cell = y + (gl-rl)/2
+			for _, r := range group.Ruby {
+				glyph := place(ruby, rubyEm, r, rubyX, cell)
+				glyph.Ruby, glyph.Highlight = true, lit
+				layout.Glyphs = append(layout.Glyphs, glyph)
+				cell += cellHeight(ruby, rubyEm, r)
+			}
+
+			y += gl
+		}
+	}
+
+	return layout
+}
+
+// Returns the width a group takes in a line, the wider of base and ruby, along with both of them
+func groupWidth(group rubyGroup, base font.Face, ruby font.Face) (fixed.Int26_6, fixed.Int26_6, fixed.Int26_6) {
+	bw, rw := font.MeasureString(base, group.Base), font.MeasureString(ruby, group.Ruby)
+	if rw > bw {
+		return rw, bw, rw
+	}
+
+	return bw, bw, rw
+}
+
+// Returns the height a group takes in a column with cells of em pixels, the longer of base and ruby
+func groupHeight(group rubyGroup, em float64, base font.Face, ruby font.Face) float64 {
+	return math.Max(columnLength(base, em, group.Base), columnLength(ruby, em*RUBY_SCALE, group.Ruby))
+}
+
+// Returns the height text takes in a column with cells of size pixels
+func columnLength(face font.Face, size float64, text string) (total float64) {
+	for _, r := range text {
+		total += cellHeight(face, size, r)
+	}
+
+	return
+}
+
+// Returns the height of a glyph in a column, upright glyphs take a square cell and turned ones their width
+func cellHeight(face font.Face, size float64, r rune) float64 {
+	if isTurned(r) {
+		advance, _ := face.GlyphAdvance(r)
+		return float64(advance) / 64
+	}
+
+	return size
+}
+
+// Returns true if any of the lines has ruby
+func hasRuby(lines [][]rubyGroup) bool {
+	for _, groups := range lines {
+		for _, group := range groups {
+			if len(group.Ruby) > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns true for characters turned sideways in vertical text, like ー and half width letters
+func isTurned(r rune) bool {
+	return (r < 0x1100 && !unicode.IsSpace(r)) || strings.ContainsRune(VERTICAL_TURNED, r)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRuby(t *testing.T) {
+
+	tests := []struct {
+		line     string
+		expected []rubyGroup
+	}{
+		{"漢字", []rubyGroup{{Base: "漢字"}}},
+		{"", []rubyGroup{{Base: ""}}},
+		{"この漢字《かんじ》です", []rubyGroup{{Base: "この"}, {Base: "漢字", Ruby: "かんじ"}, {Base: "です"}}},
+		{"｜東京タワー《とうきょうタワー》", []rubyGroup{{Base: "東京タワー", Ruby: "とうきょうタワー"}}},
+		{"人々《ひとびと》", []rubyGroup{{Base: "人々", Ruby: "ひとびと"}}},
+		{"かな《かな》", []rubyGroup{{Base: "かな《かな》"}}},
+		{"漢字《かんじ", []rubyGroup{{Base: "漢字《かんじ"}}},
+		{"a｜b", []rubyGroup{{Base: "a｜b"}}},
+	}
+
+	for _, test := range tests {
+		if groups := parseRuby(test.line); !cmp.Equal(groups, test.expected) {
+			t.Errorf("Parsing ruby of %q gave %+v", test.line, groups)
+		}
+	}
+}
+
+func TestHighlightMask(t *testing.T) {
+	mask := highlightMask([]rune("aba漢字abab"), "ab")
+	expected := []bool{true, true, false, false, false, true, true, true, true}
+	if !cmp.Equal(mask, expected) {
+		t.Errorf("Highlight mask is %v", mask)
+	}
+}
+
+func TestVerticalLayout(t *testing.T) {
+
+	useTestFont(t)
+	face := func(size float64) *fallbackFace {
+		return newFallbackFace(fontChain(fontTtf), &truetype.Options{Size: size, DPI: fontDpi})
+	}
+	base, ruby := face(fontSize), face(fontSize*RUBY_SCALE)
+
+	lines := [][]rubyGroup{parseRuby("｜ab《x》ー"), parseRuby("、")}
+	vertical := layoutVertical(lines, "b", fontSize, base, ruby)
+	horizontal := layoutHorizontal(lines, "b", fontSize, base, ruby)
+
+	// Columns go right to left, with room for ruby on their right
+	columnWidth := vertical.Width / 2
+	if vertical.Glyphs[0].Dot.X.Round() < columnWidth || vertical.Glyphs[len(vertical.Glyphs)-1].Dot.X.Round() > columnWidth {
+		t.Errorf("Vertical columns are not right to left: %+v", vertical.Glyphs)
+	}
+
+	var turned, highlighted []rune
+	for _, glyph := range vertical.Glyphs {
+		if glyph.Turned {
+			turned = append(turned, glyph.Rune)
+		}
+		if glyph.Highlight {
+			highlighted = append(highlighted, glyph.Rune)
+		}
+	}
+	if string(turned) != "abxー" {
+		t.Errorf("Turned glyphs in vertical text are %q", string(turned))
+	}
+	if string(highlighted) != "bx" {
+		t.Errorf("Highlighted glyphs are %q", string(highlighted))
+	}
+
+	// Ruby goes above base text in horizontal text
+	for _, glyph := range horizontal.Glyphs {
+		if glyph.Turned {
+			t.Errorf("Horizontal text has turned glyph %q", glyph.Rune)
+		}
+		if glyph.Ruby && glyph.Dot.Y >= horizontal.Glyphs[0].Dot.Y {
+			t.Errorf("Ruby %q is not above its base", glyph.Rune)
+		}
+	}
+}
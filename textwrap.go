@@ -0,0 +1,222 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// Largest text image in pixels, longer text gets wrapped and drawn smaller
+const (
+	IMAGE_WIDTH_MAX  = 1200
+	IMAGE_HEIGHT_MAX = 1200
+)
+
+// Smallest font size in points text gets shrunk to, and the factor it shrinks by per try
+const (
+	FONT_SIZE_MIN     = 32
+	FONT_SHRINK_RATIO = 0.85
+)
+
+// Characters that must not start a line, following Japanese line breaking rules
+const KINSOKU_NO_START = "、。，．・：；？！）」』】〕〉》｝］〙〗ゝゞヽヾー々ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ…‥〜～.,;:!?)]}"
+
+// Characters that must not end a line
+const KINSOKU_NO_END = "（「『【〔〈《｛［〘〖([{"
+
+// Lay out text within the image size limits, wrapping lines and shrinking the font as needed
+// Text that doesn't fit even at the smallest font size gets cut off
+func fitText(input string, opts RenderOptions, chain []*truetype.Font, size float64, margin int, hinting font.Hinting) (textLayout, font.Face, font.Face) {
+
+	maxW, maxH := IMAGE_WIDTH_MAX-2*margin, IMAGE_HEIGHT_MAX-2*margin
+	for {
+		base := newFallbackFace(chain, &truetype.Options{Size: size, DPI: fontDpi, Hinting: hinting})
+		ruby := newFallbackFace(chain, &truetype.Options{Size: size * RUBY_SCALE, DPI: fontDpi, Hinting: hinting})
+
+		// Lines run along the width, columns along the height, both leaving 10% for margins and a pixel for rounding
+		em := size * fontDpi / 72
+		extent := func(group rubyGroup) float64 {
+			w, _, _ := groupWidth(group, base, ruby)
+			return float64(w) / 64
+		}
+		max := float64(maxW-1) / 1.1
+		if opts.Vertical {
+			extent = func(group rubyGroup) float64 {
+				return groupHeight(group, em, base, ruby)
+			}
+			max = float64(maxH-1) / 1.1
+		}
+
+		var lines [][]rubyGroup
+		for _, line := range strings.Split(input, "\n") {
+			groups := []rubyGroup{{Base: line}}
+			if opts.Ruby {
+				groups = parseRuby(line)
+			}
+			lines = append(lines, wrapLine(groups, max, extent)...)
+		}
+
+		layout := layoutLines(lines, opts, size, base, ruby)
+		if layout.Width <= maxW && layout.Height <= maxH {
+			return layout, base, ruby
+		}
+
+		if size <= FONT_SIZE_MIN {
+			// Keep as many lines as fit, every line taking the same room
+			count := maxH * len(lines) / layout.Height
+			if opts.Vertical {
+				count = maxW * len(lines) / layout.Width
+			}
+			if count < 1 {
+				count = 1
+			}
+			if count < len(lines) {
+				lines = lines[:count]
+				lines[count-1] = ellipsize(lines[count-1], max, extent)
+			}
+
+			return layoutLines(lines, opts, size, base, ruby), base, ruby
+		}
+
+		size = math.Max(size*FONT_SHRINK_RATIO, FONT_SIZE_MIN)
+	}
+}
+
+// Lay out lines in the direction asked for
+func layoutLines(lines [][]rubyGroup, opts RenderOptions, size float64, base font.Face, ruby font.Face) textLayout {
+	if opts.Vertical {
+		return layoutVertical(lines, opts.Highlight, size, base, ruby)
+	}
+
+	return layoutHorizontal(lines, opts.Highlight, size, base, ruby)
+}
+
+// Break a line of groups into lines no longer than max where possible
+// Half width words and ruby groups stay together unless they are longer than a line by themselves
+func wrapLine(groups []rubyGroup, max float64, extent func(rubyGroup) float64) [][]rubyGroup {
+
+	var lines [][]rubyGroup
+	var line []rubyGroup
+	var length float64
+
+	add := func(group rubyGroup, w float64) {
+		if length+w > max && len(line) > 0 {
+			lines = append(lines, mergeGroups(line))
+			line, length = nil, 0
+		}
+		line = append(line, group)
+		length += w
+	}
+
+	for _, unit := range breakUnits(groups) {
+		var w float64
+		for _, group := range unit {
+			w += extent(group)
+		}
+
+		if w > max {
+			for _, group := range unit {
+				add(group, extent(group))
+			}
+			continue
+		}
+
+		if length+w > max && len(line) > 0 {
+			lines = append(lines, mergeGroups(line))
+			line, length = nil, 0
+		}
+		line = append(line, unit...)
+		length += w
+	}
+
+	return append(lines, mergeGroups(line))
+}
+
+// End a cut off line with an ellipsis, dropping units at its end to make room for it
+func ellipsize(groups []rubyGroup, max float64, extent func(rubyGroup) float64) []rubyGroup {
+
+	ellipsis := rubyGroup{Base: "…"}
+	units := breakUnits(groups)
+	length := extent(ellipsis)
+	for _, unit := range units {
+		for _, group := range unit {
+			length += extent(group)
+		}
+	}
+
+	for length > max && len(units) > 0 {
+		for _, group := range units[len(units)-1] {
+			length -= extent(group)
+		}
+		units = units[:len(units)-1]
+	}
+
+	var line []rubyGroup
+	for _, unit := range units {
+		line = append(line, unit...)
+	}
+
+	return mergeGroups(append(line, ellipsis))
+}
+
+// Split groups into units a line may break between
+// Plain text can break between any characters except around kinsoku characters, inside half width words and before spaces
+func breakUnits(groups []rubyGroup) [][]rubyGroup {
+
+	var units [][]rubyGroup
+	prev := rune(-1)
+	for _, group := range groups {
+		pieces := []rubyGroup{group}
+		if len(group.Ruby) == 0 {
+			pieces = nil
+			for _, r := range group.Base {
+				pieces = append(pieces, rubyGroup{Base: string(r)})
+			}
+		}
+
+		for _, piece := range pieces {
+			first, _ := utf8.DecodeRuneInString(piece.Base)
+			join := len(units) > 0 && (unicode.IsSpace(first) ||
+				strings.ContainsRune(KINSOKU_NO_START, first) ||
+				strings.ContainsRune(KINSOKU_NO_END, prev) ||
+				(isHalfWidth(prev) && isHalfWidth(first)))
+
+			if join {
+				units[len(units)-1] = append(units[len(units)-1], piece)
+			} else {
+				units = append(units, []rubyGroup{piece})
+			}
+			prev, _ = utf8.DecodeLastRuneInString(piece.Base)
+		}
+	}
+
+	return units
+}
+
+// Returns true for half width characters other than spaces, which make up words
+func isHalfWidth(r rune) bool {
+	return r >= 0 && r < 0x1100 && !unicode.IsSpace(r)
+}
+
+// Join neighbouring groups without ruby, so that they get kerned together
+// An empty line stays a single empty group
+func mergeGroups(groups []rubyGroup) []rubyGroup {
+
+	var merged []rubyGroup
+	for _, group := range groups {
+		if n := len(merged); n > 0 && len(group.Ruby) == 0 && len(merged[n-1].Ruby) == 0 {
+			merged[n-1].Base += group.Base
+			continue
+		}
+		merged = append(merged, group)
+	}
+	if len(merged) == 0 {
+		merged = []rubyGroup{{}}
+	}
+
+	return merged
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBreakUnits(t *testing.T) {
+
+	var units []string
+	for _, unit := range breakUnits([]rubyGroup{{Base: "今日は。（晴れ）hello world"}}) {
+		units = append(units, rubyBase(unit))
+	}
+
+	// Closing marks stay with the character before, opening ones with the one after, and words stay whole
+	expected := []string{"今", "日", "は。", "（晴", "れ）", "hello ", "world"}
+	if !cmp.Equal(units, expected) {
+		t.Errorf("Break units are %q, expected %q", units, expected)
+	}
+}
+
+func TestWrapLine(t *testing.T) {
+
+	runes := func(group rubyGroup) float64 {
+		return float64(len([]rune(group.Base)))
+	}
+
+	tests := []struct {
+		line     string
+		max      float64
+		expected []string
+	}{
+		{"今日は。（晴れ）", 4, []string{"今日は。", "（晴れ）"}},
+		{"今日は。（晴れ）", 3, []string{"今日", "は。", "（晴", "れ）"}},
+		{"abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"ab cd", 10, []string{"ab cd"}},
+		{"", 3, []string{""}},
+	}
+
+	for _, test := range tests {
+		var lines []string
+		for _, line := range wrapLine([]rubyGroup{{Base: test.line}}, test.max, runes) {
+			lines = append(lines, rubyBase(line))
+		}
+		if !cmp.Equal(lines, test.expected) {
+			t.Errorf("Wrapping %q at %v gave %q, expected %q", test.line, test.max, lines, test.expected)
+		}
+	}
+}
+
+func TestFitText(t *testing.T) {
+
+	useTestFont(t)
+
+	for _, opts := range []RenderOptions{{}, {Vertical: true}, {Distort: true}} {
+		img := decodeRender(t, strings.Repeat("quiz words ", 1000), opts)
+		if b := img.Bounds(); b.Dx() > IMAGE_WIDTH_MAX || b.Dy() > IMAGE_HEIGHT_MAX {
+			t.Errorf("Long text with %+v gave image of %v, larger than %dx%d", opts, b, IMAGE_WIDTH_MAX, IMAGE_HEIGHT_MAX)
+		}
+	}
+
+	// Text wider than the image gets wrapped onto more lines
+	wide := decodeRender(t, strings.Repeat("quiz ", 20), RenderOptions{})
+	lineHeight := int(fontSize * fontDpi / 72 * LINE_SPACING)
+	if b := wide.Bounds(); b.Dx() > IMAGE_WIDTH_MAX || b.Dy() < 2*lineHeight {
+		t.Errorf("Wide text was not wrapped into an image of %v", b)
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+
+	runes := func(group rubyGroup) float64 {
+		return float64(len([]rune(group.Base)))
+	}
+
+	if line := rubyBase(ellipsize([]rubyGroup{{Base: "今日は。（晴れ）"}}, 5, runes)); line != "今日は。…" {
+		t.Errorf("Cut off line is %q", line)
+	}
+}
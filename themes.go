@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for saved guild and user themes
+const THEMES_FILE = "themes.json"
+
+// Range of font sizes in points and padding in pixels a theme can set
+const (
+	THEME_SIZE_MIN    = 24
+	THEME_SIZE_MAX    = 144
+	THEME_PADDING_MAX = 200
+)
+
+// Colours text images are drawn in
+type Palette struct {
+	Foreground color.RGBA
+	Background color.RGBA
+	Highlight  color.RGBA
+}
+
+// Colour presets themes can pick, light being the default
+var Palettes = map[string]Palette{
+	"light":    {color.RGBA{0x00, 0x00, 0x00, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, color.RGBA{0xCC, 0x22, 0x22, 0xFF}},
+	"dark":     {color.RGBA{0xDC, 0xDD, 0xDE, 0xFF}, color.RGBA{0x36, 0x39, 0x3F, 0xFF}, color.RGBA{0xFF, 0x73, 0x73, 0xFF}},
+	"contrast": {color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, color.RGBA{0x00, 0x00, 0x00, 0xFF}, color.RGBA{0xFF, 0xFF, 0x00, 0xFF}},
+}
+
+// Named font sizes in points
+var ThemeSizes = map[string]float64{
+	"small":  48,
+	"normal": 72,
+	"large":  96,
+	"huge":   128,
+}
+
+// Theme holds how text images look for a guild or user
+type Theme struct {
+	Colours     string  `json:"colours,omitempty"`     // Palette name, empty for light
+	Size        float64 `json:"size,omitempty"`        // Font size in points, 0 for the default
+	Padding     int     `json:"padding,omitempty"`     // Extra pixels around the text
+	Transparent bool    `json:"transparent,omitempty"` // Leave the background transparent
+	Distort     bool    `json:"distort,omitempty"`     // Distort quiz question images against OCR
+}
+
+// Returns the colours of the theme, falling back to the light palette
+func (t Theme) Palette() Palette {
+	if palette, ok := Palettes[t.Colours]; ok {
+		return palette
+	}
+
+	return Palettes["light"]
+}
+
+// Returns the palette with the colours set in custom going over its own, unset ones being transparent
+func (p Palette) override(custom Palette) Palette {
+	if custom.Foreground.A > 0 {
+		p.Foreground = custom.Foreground
+	}
+	if custom.Background.A > 0 {
+		p.Background = custom.Background
+	}
+	if custom.Highlight.A > 0 {
+		p.Highlight = custom.Highlight
+	}
+
+	return p
+}
+
+func (t Theme) String() string {
+	colours := t.Colours
+	if len(colours) == 0 {
+		colours = "light"
+	}
+	size := t.Size
+	if size == 0 {
+		size = fontSize
+	}
+
+	onOff := map[bool]string{true: "on", false: "off"}
+	return fmt.Sprintf("%s, size %.f, padding %d, transparent %s, distort %s", colours, size, t.Padding, onOff[t.Transparent], onOff[t.Distort])
+}
+
+// Saved themes, keyed by guild:<id> and user:<id>
+var Themes struct {
+	sync.RWMutex
+	Map map[string]Theme
+}
+
+// Returns the saved theme for a key, or the default theme
+func getTheme(key string) (Theme, bool) {
+	Themes.RLock()
+	theme, ok := Themes.Map[key]
+	Themes.RUnlock()
+
+	return theme, ok
+}
+
+// Saves a theme for a key, or removes it for the default theme
+func putTheme(key string, theme Theme) {
+	Themes.Lock()
+	if theme == (Theme{}) {
+		delete(Themes.Map, key)
+	} else {
+		Themes.Map[key] = theme
+	}
+	Themes.Unlock()
+
+	writeThemes()
+}
+
+// Returns the theme for images sent to a channel: the recipient's theme in Direct Messages, the guild's otherwise
+func channelTheme(s *discordgo.Session, cid string) Theme {
+
+	ch, err := s.State.Channel(cid)
+	if err != nil {
+		return Theme{}
+	}
+
+	if ch.Type&discordgo.ChannelTypeDM != 0 {
+		for _, user := range ch.Recipients {
+			if theme, ok := getTheme("user:" + user.ID); ok {
+				return theme
+			}
+		}
+		return Theme{}
+	}
+
+	theme, _ := getTheme("guild:" + ch.GuildID)
+	return theme
+}
+
+// Returns the theme for images a user asked for, like drawings: their own theme if they set one, the channel's otherwise
+func userTheme(s *discordgo.Session, cid string, uid string) Theme {
+	if theme, ok := getTheme("user:" + uid); ok {
+		return theme
+	}
+
+	return channelTheme(s, cid)
+}
+
+// Change a theme according to arguments like dark, size=large, padding=20, transparent=on or distort=on
+// A reset argument starts over from the default theme
+func parseTheme(theme Theme, args []string) (Theme, error) {
+
+	for _, arg := range args {
+		parts := strings.SplitN(strings.ToLower(arg), "=", 2)
+		if len(parts) == 1 {
+			if parts[0] == "reset" {
+				theme = Theme{}
+			} else if _, ok := Palettes[parts[0]]; ok {
+				theme.Colours = parts[0]
+			} else {
+				return theme, fmt.Errorf("Unknown colours '%s', choose from %s", parts[0], strings.Join(paletteNames(), ", "))
+			}
+			continue
+		}
+
+		key, value := parts[0], parts[1]
+		switch key {
+		case "size":
+			size, err := parseSize(value)
+			if err != nil {
+				return theme, err
+			}
+			theme.Size = size
+		case "padding":
+			padding, err := strconv.Atoi(value)
+			if err != nil || padding < 0 || padding > THEME_PADDING_MAX {
+				return theme, fmt.Errorf("Padding must be 0 to %d pixels", THEME_PADDING_MAX)
+			}
+			theme.Padding = padding
+		case "transparent":
+			theme.Transparent = isEnabled(value)
+		case "distort":
+			theme.Distort = isEnabled(value)
+		default:
+			return theme, fmt.Errorf("Unknown theme setting '%s'", key)
+		}
+	}
+
+	return theme, nil
+}
+
+// Returns the font size for a size name or number of points, 0 for the default size
+func parseSize(value string) (float64, error) {
+
+	size, ok := ThemeSizes[strings.ToLower(value)]
+	if !ok {
+		var err error
+		// NaN passes any range check, and ParseFloat reads nan and inf
+		if size, err = strconv.ParseFloat(value, 64); err != nil || math.IsNaN(size) || math.IsInf(size, 0) || size < THEME_SIZE_MIN || size > THEME_SIZE_MAX {
+			return 0, fmt.Errorf("Size must be small, normal, large, huge or %d to %d points", THEME_SIZE_MIN, THEME_SIZE_MAX)
+		}
+	}
+	if size == fontSize {
+		size = 0
+	}
+
+	return size, nil
+}
+
+// Returns the palette names in alphabetical order
+func paletteNames() []string {
+	var names []string
+	for name := range Palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Show or change the theme of the message author, or of the guild with the server argument
+func themeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+
+	key := "user:" + m.Author.ID
+	scope := "Your"
+	if len(args) > 0 && strings.ToLower(args[0]) == "server" {
+		args = args[1:]
+
+		ch, err := s.State.Channel(m.ChannelID)
+		if err != nil || ch.Type&discordgo.ChannelTypeDM != 0 {
+			msgSend(s, m.ChannelID, "Error: Server themes can only be set in a server channel.")
+			return
+		}
+
+		// Changing server themes takes the right to manage the server
+		if len(args) > 0 && m.Author.ID != Settings.Owner.ID {
+			perms, err := s.UserChannelPermissions(m.Author.ID, m.ChannelID)
+			if err != nil || perms&discordgo.PermissionManageServer == 0 {
+				msgSend(s, m.ChannelID, "Error: Changing the server theme needs the Manage Server permission.")
+				return
+			}
+		}
+
+		key = "guild:" + ch.GuildID
+		scope = "Server"
+	}
+
+	theme, _ := getTheme(key)
+	if len(args) == 0 {
+		msgSend(s, m.ChannelID, fmt.Sprintf("%s theme: %s", scope, theme))
+		return
+	}
+
+	theme, err := parseTheme(theme, args)
+	if err != nil {
+		msgSend(s, m.ChannelID, fmt.Sprintf("Error: %s\nUsage: `%stheme [server] [%s] [size=<small/normal/large/huge/N>] [padding=N] [transparent=<on/off>] [distort=<on/off>] [reset]`", err, CMD_PREFIX, strings.Join(paletteNames(), "/")))
+		return
+	}
+
+	putTheme(key, theme)
+
+	// Quizzes in servers are for everyone, so they keep the server theme
+	msg := fmt.Sprintf("%s theme set to: %s", scope, theme)
+	if ch, err := s.State.Channel(m.ChannelID); scope == "Your" && err == nil && ch.Type&discordgo.ChannelTypeDM == 0 {
+		msg += "\nIt applies to your own drawings and kanji lookups here, quiz images only follow it in Direct Messages."
+	}
+	msgSend(s, m.ChannelID, msg)
+}
+
+// Writes Themes map as JSON to disk
+func writeThemes() {
+	Themes.RLock()
+	b, err := json.Marshal(Themes.Map)
+	Themes.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Themes to json: ", err)
+	} else if err = ioutil.WriteFile(THEMES_FILE, b, 0644); err != nil {
+		log.Println("ERROR, Could not write Themes file to disk: ", err)
+	}
+}
+
+// Load Themes map from JSON on disk
+func loadThemes() {
+
+	Themes.Lock()
+	defer Themes.Unlock()
+
+	Themes.Map = make(map[string]Theme)
+
+	file, err := ioutil.ReadFile(THEMES_FILE)
+	if err != nil {
+		log.Println("ERROR, Reading Themes json: ", err)
+		return
+	}
+
+	err = json.Unmarshal(file, &Themes.Map)
+	if err != nil {
+		log.Println("ERROR, Unmarshalling Themes json: ", err)
+	}
+
+	if Themes.Map == nil {
+		Themes.Map = make(map[string]Theme)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseTheme(t *testing.T) {
+
+	theme, err := parseTheme(Theme{}, []string{"dark", "size=large", "padding=20", "transparent=on", "distort=on"})
+	if err != nil || theme != (Theme{Colours: "dark", Size: 96, Padding: 20, Transparent: true, Distort: true}) {
+		t.Errorf("Parsing theme gave %+v, %v", theme, err)
+	}
+
+	if theme, err = parseTheme(theme, []string{"reset", "size=40"}); err != nil || theme != (Theme{Size: 40}) {
+		t.Errorf("Resetting theme gave %+v, %v", theme, err)
+	}
+	if theme, err = parseTheme(theme, []string{"size=normal"}); err != nil || theme != (Theme{}) {
+		t.Errorf("Default size should be left out of theme, got %+v", theme)
+	}
+
+	for _, args := range [][]string{{"pink"}, {"size=1000"}, {"size=nan"}, {"size=inf"}, {"padding=-1"}, {"font=mincho"}} {
+		if _, err := parseTheme(Theme{}, args); err == nil {
+			t.Errorf("Parsing theme %v should fail", args)
+		}
+	}
+}
+
+func TestThemeRender(t *testing.T) {
+
+	useTestFont(t)
+
+	plain := decodeRender(t, "theme", RenderOptions{})
+	themed := decodeRender(t, "theme", RenderOptions{Theme: Theme{Colours: "dark", Size: 96, Padding: 10}})
+	transparent := decodeRender(t, "theme", RenderOptions{Theme: Theme{Transparent: true}})
+
+	if themed.Bounds().Dy() <= plain.Bounds().Dy()+20 || themed.Bounds().Dx() <= plain.Bounds().Dx()+20 {
+		t.Errorf("Larger padded image is %v, plain one %v", themed.Bounds(), plain.Bounds())
+	}
+	if c := color.RGBAModel.Convert(themed.At(0, 0)); c != Palettes["dark"].Background {
+		t.Errorf("Dark theme background is %v", c)
+	}
+	if _, _, _, a := transparent.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Transparent background has alpha %d", a)
+	}
+}
+
+func TestUserTheme(t *testing.T) {
+
+	s := &discordgo.Session{State: discordgo.NewState()}
+	s.State.GuildAdd(&discordgo.Guild{ID: "_guild"})
+	if err := s.State.ChannelAdd(&discordgo.Channel{ID: "_channel", GuildID: "_guild", Type: discordgo.ChannelTypeGuildText}); err != nil {
+		t.Fatal(err)
+	}
+
+	Themes.Lock()
+	saved := Themes.Map
+	Themes.Map = map[string]Theme{"guild:_guild": {Colours: "dark"}, "user:_user": {Colours: "light"}}
+	Themes.Unlock()
+	defer func() {
+		Themes.Lock()
+		Themes.Map = saved
+		Themes.Unlock()
+	}()
+
+	// Users get their own theme for what they ask for, quizzes keep the server's
+	if theme := userTheme(s, "_channel", "_user"); theme.Colours != "light" {
+		t.Errorf("User theme in server gave %+v", theme)
+	}
+	if theme := userTheme(s, "_channel", "_other"); theme.Colours != "dark" {
+		t.Errorf("User without theme in server gave %+v", theme)
+	}
+	if theme := channelTheme(s, "_channel"); theme.Colours != "dark" {
+		t.Errorf("Channel theme in server gave %+v", theme)
+	}
+}
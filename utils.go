@@ -66,6 +66,9 @@ func loadFiles() {
 	Storage.Map = make(map[string]string)
 	loadStorage()
 
+	// Initialize card statistics map
+	loadStats()
+
 	// Initialize Kanji info map
 	loadAllKanji()
 
@@ -78,6 +81,9 @@ func loadFiles() {
 	// Load font file
 	loadFont()
 
+	// Initialize image themes map
+	loadThemes()
+
 	// Load English dictionary for Scramble
 	loadScrambleDictionary()
 
@@ -130,6 +136,83 @@ func truncate(s string, n int) string {
 	return s
 }
 
+// Split quiz command arguments into max score and key=value options
+func parseQuizArgs(args []string) (winLimit string, opts map[string]string) {
+
+	opts = make(map[string]string)
+	for _, arg := range args {
+		if i := strings.Index(arg, "="); i > 0 {
+			opts[arg[:i]] = arg[i+1:]
+		} else if len(winLimit) == 0 {
+			winLimit = arg
+		}
+	}
+
+	return
+}
+
+// Turn on image distortion for quiz speeds and channel themes that use it, unless asked otherwise
+// Without either, the deck decides
+func distortQuiz(s *discordgo.Session, cid string, speed string, opts map[string]string) {
+	if _, ok := opts["distort"]; !ok && (hasString(distortSpeeds(), speed) || channelTheme(s, cid).Distort) {
+		opts["distort"] = "on"
+	}
+}
+
+// Returns the quiz speeds set to distort question images, none by default
+func distortSpeeds() []string {
+	if speeds := getStorage("distort"); len(speeds) > 0 {
+		return strings.Split(speeds, ",")
+	}
+
+	return nil
+}
+
+// Show or set the quiz speeds with distorted question images, kept in Storage
+func distortCommand(s *discordgo.Session, cid string, args []string) {
+
+	speeds := distortSpeeds()
+	if len(args) == 2 {
+		speed := strings.ToLower(args[0])
+		if _, ok := Settings.Speed[speed]; !ok && speed != "gauntlet" {
+			msgSend(s, cid, fmt.Sprintf("Error: Unknown quiz speed '%s'", speed))
+			return
+		}
+
+		var updated []string
+		for _, name := range speeds {
+			if name != speed {
+				updated = append(updated, name)
+			}
+		}
+		if isEnabled(args[1]) {
+			updated = append(updated, speed)
+		}
+		sort.Strings(updated)
+		speeds = updated
+		putStorage("distort", strings.Join(speeds, ","))
+	} else if len(args) != 0 {
+		msgSend(s, cid, fmt.Sprintf("Usage: `%sdistort [<speed> <on/off>]`", CMD_PREFIX))
+		return
+	}
+
+	if len(speeds) == 0 {
+		msgSend(s, cid, "Question images are distorted for no quiz speed.")
+	} else {
+		msgSend(s, cid, fmt.Sprintf("Question images are distorted for: %s", strings.Join(speeds, ", ")))
+	}
+}
+
+// Returns true if an option value means switched on
+func isEnabled(value string) bool {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "1":
+		return true
+	}
+
+	return false
+}
+
 // Helper function to deep copy quiz structures
 func copyQuiz(q Quiz) (cp Quiz) {
 
@@ -204,14 +287,49 @@ func msgSend(s *discordgo.Session, cid string, msg string) {
 	}
 }
 
+// Send a given message to the bot owner by Direct Message
+func reportOwner(s *discordgo.Session, msg string) {
+
+	log.Println("ERROR,", msg)
+	if s == nil || Settings.Owner == nil {
+		return
+	}
+
+	ch, err := s.UserChannelCreate(Settings.Owner.ID)
+	if err != nil {
+		log.Println("ERROR, Could not open Direct Message channel to owner: ", err)
+		return
+	}
+
+	msgSend(s, ch.ID, msg)
+}
+
 // Send an image message to Discord
 func imgSend(s *discordgo.Session, cid string, word string) {
+	imgOptionsSend(s, cid, word, RenderOptions{})
+}
+
+// Send an image message to Discord rendered with the given options
+// Without a theme of its own, the image follows the theme of the channel
+// Animated images with a countdown go out as GIF, falling back to a still image if that fails
+func imgOptionsSend(s *discordgo.Session, cid string, text string, opts RenderOptions) {
+
+	if opts.Theme == (Theme{}) {
+		opts.Theme = channelTheme(s, cid)
+	}
 
-	image := GenerateImage(word)
+	var image *bytes.Buffer
+	name := "word.png"
+	if opts.Animate && opts.Countdown > 0 {
+		image, name = RenderAnimation(text, opts), "word.gif"
+	}
+	if image == nil {
+		image, name = RenderImage(text, opts), "word.png"
+	}
 
 	// Try thrice in case of timeouts
 	retryErr := retryOnServerError(func() error {
-		_, err := s.ChannelFileSend(cid, "word.png", image)
+		_, err := s.ChannelFileSend(cid, name, image)
 		return err
 	})
 	if retryErr != nil {
@@ -219,6 +337,25 @@ func imgSend(s *discordgo.Session, cid string, word string) {
 	}
 }
 
+// Send a local image asset to Discord, resized and cropped if requested
+func assetSend(s *discordgo.Session, cid string, path string, maxSize int, crop bool) {
+
+	image, name, err := loadImageAsset(path, maxSize, crop)
+	if err != nil {
+		log.Println("ERROR, Could not load image asset:", err)
+		return
+	}
+
+	// Try thrice in case of timeouts
+	retryErr := retryOnServerError(func() error {
+		_, err := s.ChannelFileSend(cid, name, image)
+		return err
+	})
+	if retryErr != nil {
+		log.Println("ERROR, Could not send image asset:", retryErr)
+	}
+}
+
 // Send an embedded message type to Discord
 func embedSend(s *discordgo.Session, cid string, embed *discordgo.MessageEmbed) {
 
@@ -292,6 +429,11 @@ func retryOnServerError(f func() error) (err error) {
 	return
 }
 
+// Determine if given string is a web link
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
 // Determine if given line is a bot command
 func isBotCommand(s string) bool {
 
@@ -350,7 +492,8 @@ func loadAllKanji() {
 }
 
 // Return Kanji info from jitenon loaded from local cache
-func sendKanjiInfo(s *discordgo.Session, cid string, query string) error {
+// Kanji with stroke order data get a diagram attached, or the strokes frame by frame if asked for
+func sendKanjiInfo(s *discordgo.Session, cid string, query string, frames bool, theme Theme) error {
 
 	// Only grab first character, since it's a single kanji lookup
 	if len(query) == 0 {
@@ -443,6 +586,27 @@ func sendKanjiInfo(s *discordgo.Session, cid string, query string) error {
 
 	embedSend(s, cid, embed)
 
+	// Stroke order files are optional, so only asking for the frames makes a missing one an error
+	image, err := RenderStrokeOrder([]rune(query)[0], frames, theme)
+	if err != nil {
+		log.Println("ERROR, Could not draw stroke order:", err)
+	}
+	if image == nil {
+		if frames {
+			return fmt.Errorf("No stroke order for '%s', stroke order data only covers %d kanji", query, strokeCoverage())
+		}
+		return nil
+	}
+
+	// Try thrice in case of timeouts
+	retryErr := retryOnServerError(func() error {
+		_, err := s.ChannelFileSend(cid, "strokes.png", image)
+		return err
+	})
+	if retryErr != nil {
+		log.Println("ERROR, Could not send stroke order:", retryErr)
+	}
+
 	// Got this far without errors
 	return nil
 }